@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/lemoyxk/kitty"
@@ -16,15 +19,6 @@ import (
 
 func main() {
 
-	// utils.Process.Fork(run, 1)
-	//
-	// go func() {
-	// 	http.HandleFunc("/reload", func(writer http.ResponseWriter, request *http.Request) {
-	// 		utils.Process.Reload()
-	// 	})
-	// 	console.Log(http.ListenAndServe(":12345", nil))
-	// }()
-
 	run()
 	select {}
 	// utils.Signal.ListenKill().Done(func(sig os.Signal) {
@@ -162,7 +156,29 @@ func run() {
 	go tcpServer.SetRouter(tcpServerRouter).Start()
 
 	// time.AfterFunc(2*time.Second, func() {
-	// 	log.Println(tcpServer.Shutdown())
+	// 	log.Println(tcpServer.Shutdown(context.Background()))
 	// })
 
+	// kill -HUP starts a new process on the same listeners
+	// and drains the connections of this one
+	go func() {
+		var sig = make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGHUP)
+		<-sig
+
+		if _, err := kitty.Restart(); err != nil {
+			log.Println(err)
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		log.Println(webSocketServer.Shutdown(ctx))
+		log.Println(httpServer.Shutdown(ctx))
+		log.Println(tcpServer.Shutdown(ctx))
+
+		os.Exit(0)
+	}()
+
 }
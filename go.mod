@@ -5,8 +5,10 @@ go 1.16
 require (
 	github.com/golang/protobuf v1.4.3
 	github.com/gorilla/websocket v1.4.2
-	github.com/json-iterator/go v1.1.10
-	github.com/lemoyxk/caller v0.0.0-20210701150758-cdc968d4ff00 // indirect
-	github.com/lemoyxk/structure v0.0.0-20210303084734-b5c7e6a394c2
+	github.com/json-iterator/go v1.1.12
+	github.com/lemoyxk/caller v0.0.0-20210701150758-cdc968d4ff00
 	github.com/stretchr/testify v1.7.0
+	github.com/vmihailenco/msgpack/v5 v5.3.4
+	golang.org/x/net v0.0.0-20210614182718-04defd469f4e
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
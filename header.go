@@ -13,9 +13,11 @@ package kitty
 const (
 	XForwardedFor             = "X-Forwarded-For"
 	XRealIP                   = "X-Real-IP"
+	XForwardedProto           = "X-Forwarded-Proto"
 	Host                      = "Host"
 	ApplicationFormUrlencoded = "application/x-www-form-urlencoded"
 	ApplicationJson           = "application/json"
+	ApplicationProtoBuf       = "application/x-protobuf"
 	MultipartFormData         = "multipart/form-data"
 	ContentType               = "Content-Type"
 	ContentLength             = "Content-Length"
@@ -0,0 +1,452 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-16 10:25
+**/
+
+package http
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/json-iterator/go"
+
+	"github.com/lemoyxk/kitty/validate"
+)
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType     = reflect.TypeOf([]*multipart.FileHeader(nil))
+	durationType        = reflect.TypeOf(time.Duration(0))
+	timeType            = reflect.TypeOf(time.Time{})
+)
+
+// bindSources are the tags that Bind reads, the first one with a value wins.
+var bindSources = []string{"path", "query", "form", "header"}
+
+// FieldError is a field that Bind could not set.
+type FieldError struct {
+	// Field is the path of the field, like User.Name
+	Field string `json:"field"`
+	// Source is the tag, like query or json
+	Source string `json:"source"`
+	// Key is the name in the tag
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Err   error  `json:"-"`
+}
+
+func (e *FieldError) Error() string {
+	if e.Key == "" {
+		return e.Source + ": " + e.Err.Error()
+	}
+	return e.Field + " (" + e.Source + " " + e.Key + "): " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+func (e *FieldError) MarshalJSON() ([]byte, error) {
+	type field FieldError
+	var msg string
+	if e.Err != nil {
+		msg = e.Err.Error()
+	}
+	return jsoniter.Marshal(struct {
+		*field
+		Message string `json:"message"`
+	}{field: (*field)(e), Message: msg})
+}
+
+// BindError lists every field that failed.
+type BindError struct {
+	Fields []*FieldError `json:"fields"`
+}
+
+func (e *BindError) Error() string {
+	var msg = make([]string, len(e.Fields))
+	for i := 0; i < len(e.Fields); i++ {
+		msg[i] = e.Fields[i].Error()
+	}
+	return "bind: " + strings.Join(msg, "; ")
+}
+
+// Bind fills input, a pointer to a struct, from the tags of its fields:
+//
+//	type Request struct {
+//		ID     int                   `path:"id"`
+//		Page   int                   `query:"page"`
+//		Name   string                `form:"name"`
+//		Token  string                `header:"X-Token"`
+//		Avatar *multipart.FileHeader `form:"avatar"`
+//		Since  time.Time             `query:"since" layout:"2006-01-02"`
+//		User   User                  `json:"user"`
+//	}
+//
+// A json, xml, protobuf or msgpack body is decoded first by the decoder
+// of its Content-Type, see SetDecoder. Missing values keep the zero value,
+// a value that can not be parsed is in the *BindError.
+// Then the validate tags are checked, a failed rule is in the *validate.Errors.
+func (s *Stream) Bind(input interface{}) error {
+
+	var v = bindInput(input)
+
+	var b bindErrors
+
+	if err := s.decodeBody(input); err != nil {
+		if err.Source == "json" && err.Key != "" {
+			err.Field = jsonFieldPath(v.Type().Elem(), err.Key)
+		}
+		b.add(err)
+	}
+
+	walk(v.Elem(), "", func(field reflect.StructField, value reflect.Value, name string) (bool, bool) {
+
+		var handled = false
+
+		for i := 0; i < len(bindSources); i++ {
+
+			var key = tagName(field.Tag.Get(bindSources[i]))
+			if key == "" {
+				continue
+			}
+
+			handled = true
+
+			if bindSources[i] == "form" && (value.Type() == fileHeaderType || value.Type() == fileHeadersType) {
+				var files = s.bindFiles(key)
+				if len(files) == 0 {
+					continue
+				}
+				if value.Type() == fileHeaderType {
+					value.Set(reflect.ValueOf(files[0]))
+				} else {
+					value.Set(reflect.ValueOf(files))
+				}
+				return true, true
+			}
+
+			var values = s.bindValues(bindSources[i], key)
+			if len(values) == 0 {
+				continue
+			}
+
+			if err := setValues(value, values, field.Tag.Get("layout")); err != nil {
+				b.add(&FieldError{Field: name, Source: bindSources[i], Key: key, Value: values[0], Err: err})
+			}
+
+			return true, true
+		}
+
+		return handled, false
+	})
+
+	if err := b.err(); err != nil {
+		return err
+	}
+
+	return validate.Struct(input)
+}
+
+func (s *Stream) bindValues(source string, key string) []string {
+	switch source {
+	case "path":
+		for i := 0; i < len(s.Params.Keys); i++ {
+			if s.Params.Keys[i] == key {
+				return []string{s.Params.Values[i]}
+			}
+		}
+	case "query":
+		return s.ParseQuery().All(key)
+	case "form":
+		if strings.HasPrefix(s.Request.Header.Get("Content-Type"), "multipart/form-data") {
+			return s.ParseMultipart().All(key)
+		}
+		return s.ParseForm().All(key)
+	case "header":
+		return s.Request.Header.Values(key)
+	}
+	return nil
+}
+
+func (s *Stream) bindFiles(key string) []*multipart.FileHeader {
+	if !strings.HasPrefix(s.Request.Header.Get("Content-Type"), "multipart/form-data") {
+		return nil
+	}
+	return s.ParseFiles().All(key)
+}
+
+type bindErrors struct {
+	fields []*FieldError
+}
+
+func (b *bindErrors) add(err *FieldError) {
+	b.fields = append(b.fields, err)
+}
+
+func (b *bindErrors) err() error {
+	if len(b.fields) == 0 {
+		return nil
+	}
+	return &BindError{Fields: b.fields}
+}
+
+func bindInput(input interface{}) reflect.Value {
+
+	if input == nil {
+		panic("input can not be nil")
+	}
+
+	var kv = reflect.ValueOf(input)
+
+	if kv.Kind() != reflect.Ptr {
+		panic("input must be a pointer")
+	}
+
+	if kv.Type().Elem().Kind() != reflect.Struct {
+		panic("input must be a struct")
+	}
+
+	if kv.IsNil() {
+		panic("input is invalid or nil")
+	}
+
+	return kv
+}
+
+// jsonFieldError keeps the json keys of an *json.UnmarshalTypeError
+// in Key, Bind sets Field to the go names.
+func jsonFieldError(err error) *FieldError {
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) {
+		return &FieldError{Source: "json", Key: typeError.Field, Value: typeError.Value, Err: err}
+	}
+	return &FieldError{Source: "json", Err: err}
+}
+
+// jsonFieldPath returns the go names of the json keys in t, like
+// user.name is User.Name, it is empty when a key is not a field of t.
+func jsonFieldPath(t reflect.Type, keys string) string {
+
+	var parts = strings.Split(keys, ".")
+	var names = make([]string, len(parts))
+
+	for i := 0; i < len(parts); i++ {
+
+		for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+
+		if t.Kind() != reflect.Struct {
+			return ""
+		}
+
+		var field, ok = jsonField(t, parts[i])
+		if !ok {
+			return ""
+		}
+
+		names[i] = field.Name
+		t = field.Type
+	}
+
+	return strings.Join(names, ".")
+}
+
+// jsonField returns the field of the json key, an embedded
+// struct is in the keys of encoding/json by its go name.
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		var field = t.Field(i)
+		var tag = field.Tag.Get("json")
+		if field.PkgPath != "" && !field.Anonymous || tag == "-" {
+			continue
+		}
+		var name = tagName(tag)
+		if name == "" {
+			name = field.Name
+		}
+		if name == key {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// tagName drops the options of a tag, like ,omitempty.
+func tagName(tag string) string {
+	if i := strings.IndexByte(tag, ','); i != -1 {
+		tag = tag[:i]
+	}
+	if tag == "-" {
+		return ""
+	}
+	return tag
+}
+
+// walk calls fn with every exported field and goes into the nested
+// structs that fn does not handle, it returns true when a field is set.
+func walk(v reflect.Value, prefix string, fn func(field reflect.StructField, value reflect.Value, name string) (bool, bool)) bool {
+
+	var set = false
+
+	var t = v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+
+		var field = t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		var value = v.Field(i)
+		var name = prefix + field.Name
+
+		if field.PkgPath == "" {
+			handled, ok := fn(field, value, name)
+			if handled {
+				set = set || ok
+				continue
+			}
+		}
+
+		var ft = field.Type
+
+		if ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct && !isLeaf(ft.Elem()) && value.CanSet() {
+			var ptr = value
+			if value.IsNil() {
+				ptr = reflect.New(ft.Elem())
+			}
+			if walk(ptr.Elem(), name+".", fn) {
+				value.Set(ptr)
+				set = true
+			}
+			continue
+		}
+
+		if ft.Kind() == reflect.Struct && !isLeaf(ft) {
+			if walk(value, name+".", fn) {
+				set = true
+			}
+		}
+	}
+
+	return set
+}
+
+// isLeaf reports whether a struct is set from a single value.
+func isLeaf(t reflect.Type) bool {
+	return t == timeType || reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+func setValues(v reflect.Value, values []string, layout string) error {
+
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 && !reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+		var slice = reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i := 0; i < len(values); i++ {
+			if err := setValue(slice.Index(i), values[i], layout); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+
+	return setValue(v, values[0], layout)
+}
+
+func setValue(v reflect.Value, value string, layout string) error {
+
+	if v.Kind() == reflect.Ptr {
+		var ptr = reflect.New(v.Type().Elem())
+		if err := setValue(ptr.Elem(), value, layout); err != nil {
+			return err
+		}
+		v.Set(ptr)
+		return nil
+	}
+
+	if v.Type() == timeType && layout != "" {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		r, err := parseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(r)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		r, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(r)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		r, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(r)
+	case reflect.Float32, reflect.Float64:
+		r, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(r)
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return errors.New("unsupported type " + v.Type().String())
+		}
+		v.SetBytes([]byte(value))
+	default:
+		return errors.New("unsupported type " + v.Type().String())
+	}
+
+	return nil
+}
+
+// parseBool accepts the values of strconv.ParseBool and on or off of a checkbox.
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return strconv.ParseBool(strings.ToLower(value))
+}
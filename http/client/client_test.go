@@ -11,14 +11,47 @@
 package client
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"mime/multipart"
+	"net"
 	http3 "net/http"
 	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/json-iterator/go"
 	"github.com/lemoyxk/kitty"
+	awesomepackage "github.com/lemoyxk/kitty/example/protobuf"
 	"github.com/lemoyxk/kitty/http"
 	"github.com/lemoyxk/kitty/http/server"
+	"github.com/lemoyxk/kitty/session"
 	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+	"golang.org/x/net/http2"
 )
 
 var httpServer *server.Server
@@ -83,3 +116,1868 @@ func Test_Static_File(t *testing.T) {
 	assert.True(t, len(Get(ts.URL+"/1.png").Query().Send().Bytes()) == 2853516)
 	assert.True(t, Get(ts.URL+"/test.txt").Query().Send().String() == "hello static!")
 }
+
+func Test_Method_Same_Path(t *testing.T) {
+
+	var httpServerRouter = &server.Router{}
+
+	httpServerRouter.Route("GET", "/users").Handler(func(stream *http.Stream) error {
+		return stream.EndString("get users")
+	})
+
+	httpServerRouter.Route("POST", "/users").Handler(func(stream *http.Stream) error {
+		return stream.EndString("post users")
+	})
+
+	httpServer.SetRouter(httpServerRouter)
+
+	assert.True(t, Get(ts.URL+"/users").Query().Send().String() == "get users")
+	assert.True(t, Post(ts.URL+"/users").Form().Send().String() == "post users")
+	assert.True(t, len(httpServerRouter.GetAllRouters()) == 2)
+}
+
+func Test_Method_Not_Allowed(t *testing.T) {
+
+	var httpServerRouter = &server.Router{}
+
+	httpServerRouter.Route("GET", "/users").Handler(func(stream *http.Stream) error {
+		return stream.EndString("get users")
+	})
+
+	httpServerRouter.Route("PUT", "/users").Handler(func(stream *http.Stream) error {
+		return stream.EndString("put users")
+	})
+
+	httpServer.SetRouter(httpServerRouter)
+
+	var res = Post(ts.URL + "/users").Form().Send()
+	assert.True(t, res.Code() == http3.StatusMethodNotAllowed)
+	assert.True(t, res.Response().Header.Get("Allow") == "GET, HEAD, PUT, OPTIONS")
+
+	req, _ := http3.NewRequest(http3.MethodOptions, ts.URL+"/users", nil)
+	response, err := ts.Client().Do(req)
+	assert.True(t, err == nil, err)
+	assert.True(t, response.StatusCode == http3.StatusNoContent)
+	assert.True(t, response.Header.Get("Allow") == "GET, HEAD, PUT, OPTIONS")
+
+	res = Head(ts.URL + "/users").Query().Send()
+	assert.True(t, res.Code() == http3.StatusOK)
+	assert.True(t, res.String() == "")
+	assert.True(t, res.Response().Header.Get("Content-Length") == "9", res.Response().Header)
+
+	// a streaming handler can flush on HEAD
+	httpServerRouter.Route("GET", "/stream").Handler(func(stream *http.Stream) error {
+		if _, ok := stream.Response.(http3.Flusher); !ok {
+			stream.Response.WriteHeader(http3.StatusInternalServerError)
+			return nil
+		}
+		return stream.Flush()
+	})
+
+	res = Head(ts.URL + "/stream").Query().Send()
+	assert.True(t, res.Code() == http3.StatusOK, res.Code())
+}
+
+func Test_Route_Constraint(t *testing.T) {
+
+	var httpServerRouter = &server.Router{}
+
+	httpServerRouter.Route("GET", "/users/{id:int}").Handler(func(stream *http.Stream) error {
+		return stream.EndString("id " + stream.Params.ByName("id"))
+	})
+
+	httpServerRouter.Route("GET", "/users/:name").Handler(func(stream *http.Stream) error {
+		return stream.EndString("name " + stream.Params.ByName("name"))
+	})
+
+	httpServerRouter.Route("GET", "/files/*path").Handler(func(stream *http.Stream) error {
+		return stream.EndString("path " + stream.Params.ByName("path"))
+	})
+
+	httpServer.SetRouter(httpServerRouter)
+
+	assert.True(t, Get(ts.URL+"/users/1").Query().Send().String() == "id 1")
+	assert.True(t, Get(ts.URL+"/users/kitty").Query().Send().String() == "name kitty")
+	assert.True(t, Get(ts.URL+"/files/a/b.txt").Query().Send().String() == "path a/b.txt")
+
+	assert.Panics(t, func() {
+		httpServerRouter.Route("POST", "/users/{uid:int}").Handler(func(stream *http.Stream) error {
+			return nil
+		})
+	})
+
+	// two constraints that match the same value, both routes are named
+	func() {
+		defer func() {
+			var msg = fmt.Sprint(recover())
+			assert.True(t, strings.Count(msg, "client_test.go:") == 2, msg)
+		}()
+		httpServerRouter.Route("GET", "/users/{id:[0-9]+}").Handler(func(stream *http.Stream) error {
+			return nil
+		})
+	}()
+}
+
+func Test_Route_URL(t *testing.T) {
+
+	var httpServerRouter = &server.Router{}
+
+	httpServerRouter.Group("/users").Handler(func(handler *server.RouteHandler) {
+		handler.Get("/{id:int}/files/:name").Name("user.file").Handler(func(stream *http.Stream) error {
+			return stream.EndString(stream.Params.ByName("name"))
+		})
+	})
+
+	httpServer.SetRouter(httpServerRouter)
+
+	url, err := httpServerRouter.URL("user.file", kitty.Params{Keys: []string{"id", "name"}, Values: []string{"1", "a b"}})
+	assert.True(t, err == nil, err)
+	assert.True(t, url == "/users/1/files/a%20b", url)
+	assert.True(t, Get(ts.URL+url).Query().Send().String() == "a b")
+
+	_, err = httpServerRouter.URL("user.file", kitty.Params{Keys: []string{"id"}, Values: []string{"1"}})
+	assert.True(t, err != nil)
+
+	_, err = httpServerRouter.URL("user.show", kitty.Params{})
+	assert.True(t, err != nil)
+}
+
+func Test_Route_Remove_Name(t *testing.T) {
+
+	var httpServerRouter = &server.Router{}
+
+	httpServerRouter.Route("GET", "/a/:id").Name("a").Handler(func(stream *http.Stream) error {
+		return stream.EndString("old")
+	})
+
+	httpServerRouter.Remove("/a/:id")
+
+	_, err := httpServerRouter.URL("a", kitty.Params{Keys: []string{"id"}, Values: []string{"1"}})
+	assert.True(t, err != nil)
+
+	// the name can be used again
+	httpServerRouter.Route("GET", "/a/:id").Name("a").Handler(func(stream *http.Stream) error {
+		return stream.EndString("new")
+	})
+
+	httpServer.SetRouter(httpServerRouter)
+
+	url, err := httpServerRouter.URL("a", kitty.Params{Keys: []string{"id"}, Values: []string{"1"}})
+	assert.True(t, err == nil && url == "/a/1", err)
+	assert.True(t, Get(ts.URL+url).Query().Send().String() == "new")
+
+	// a conflict does not take the name
+	func() {
+		defer func() { assert.True(t, recover() != nil) }()
+		httpServerRouter.Route("GET", "/a/:id").Name("b").Handler(func(stream *http.Stream) error { return nil })
+	}()
+	_, err = httpServerRouter.URL("b", kitty.Params{Keys: []string{"id"}, Values: []string{"1"}})
+	assert.True(t, err != nil)
+}
+
+func Test_OpenAPI(t *testing.T) {
+
+	type User struct {
+		ID      int      `json:"id"`
+		Name    string   `json:"name"`
+		Friends []*User  `json:"friends"`
+		Tags    []string `json:"tags,omitempty"`
+		secret  string
+	}
+
+	var httpServerRouter = &server.Router{}
+
+	httpServerRouter.Group("/users").Handler(func(handler *server.RouteHandler) {
+		handler.Get("/{id:int}").Name("user.show").Doc(server.Doc{
+			Summary:  "show user",
+			Tags:     []string{"user"},
+			Response: User{},
+		}).Handler(func(stream *http.Stream) error {
+			return nil
+		})
+		handler.Post("/:id").Doc(server.Doc{Request: &User{}}).Handler(func(stream *http.Stream) error {
+			return nil
+		})
+	})
+
+	// another type with the same name
+	var team = func() interface{} {
+		type User struct {
+			Team string `json:"team"`
+		}
+		return User{}
+	}()
+
+	httpServerRouter.Route("GET", "/v2/teams").Doc(server.Doc{Response: team}).Handler(func(stream *http.Stream) error {
+		return nil
+	})
+
+	httpServer.SetRouter(httpServerRouter)
+
+	httpServer.OpenAPI = &server.OpenAPI{Path: "/openapi.json", Title: "kitty", Version: "1.0.0"}
+	defer func() { httpServer.OpenAPI = nil }()
+
+	var res = Get(ts.URL + "/openapi.json").Query().Send()
+	var doc = jsoniter.Get(res.Bytes())
+
+	assert.True(t, doc.Get("openapi").ToString() == "3.0.3")
+	assert.True(t, doc.Get("paths", "/users/{id}", "get", "operationId").ToString() == "user.show")
+	assert.True(t, doc.Get("paths", "/users/{id}", "get", "parameters", 0, "schema", "type").ToString() == "integer")
+	assert.True(t, doc.Get("paths", "/users/{id}", "post", "requestBody", "content", "application/json", "schema", "$ref").ToString() == "#/components/schemas/User")
+	assert.True(t, doc.Get("components", "schemas", "User", "properties", "friends", "items", "$ref").ToString() == "#/components/schemas/User")
+	assert.True(t, doc.Get("components", "schemas", "User", "properties", "secret").LastError() != nil)
+
+	var userRef = doc.Get("paths", "/users/{id}", "get", "responses", "200", "content", "application/json", "schema", "$ref").ToString()
+	var teamRef = doc.Get("paths", "/v2/teams", "get", "responses", "200", "content", "application/json", "schema", "$ref").ToString()
+	assert.True(t, userRef == "#/components/schemas/User" && teamRef == "#/components/schemas/User2", teamRef)
+	assert.True(t, doc.Get("components", "schemas", strings.TrimPrefix(userRef, "#/components/schemas/"), "properties", "friends").LastError() == nil)
+	assert.True(t, doc.Get("components", "schemas", strings.TrimPrefix(teamRef, "#/components/schemas/"), "properties", "team").LastError() == nil)
+
+	httpServer.OpenAPI.Path = "/openapi.yaml"
+	res = Get(ts.URL + "/openapi.yaml").Query().Send()
+	assert.True(t, strings.Contains(res.String(), "openapi: 3.0.3"), res.String())
+
+	// the middleware protects the document
+	var srv = &server.Server{OpenAPI: &server.OpenAPI{Path: "/openapi.json"}}
+	var docTS = httptest.NewServer(srv)
+	defer docTS.Close()
+
+	srv.Use(func(next server.Middle) server.Middle {
+		return func(stream *http.Stream) {
+			if stream.Request.Header.Get("Authorization") != "secret" {
+				stream.Response.WriteHeader(http3.StatusUnauthorized)
+				return
+			}
+			next(stream)
+		}
+	})
+	srv.SetRouter(httpServerRouter)
+
+	res = Get(docTS.URL + "/openapi.json").Query().Send()
+	assert.True(t, res.Code() == http3.StatusUnauthorized, res.Code())
+	res = Get(docTS.URL+"/openapi.json").SetHeader("Authorization", "secret").Query().Send()
+	assert.True(t, res.Code() == http3.StatusOK && jsoniter.Get(res.Bytes(), "openapi").ToString() == "3.0.3")
+}
+
+func Test_Host_Router(t *testing.T) {
+
+	var defaultRouter = &server.Router{}
+	defaultRouter.Route("GET", "/who").Handler(func(stream *http.Stream) error {
+		return stream.EndString("default")
+	})
+
+	var apiRouter = &server.Router{}
+	apiRouter.Route("GET", "/who").Handler(func(stream *http.Stream) error {
+		return stream.EndString("api")
+	})
+
+	var tenantRouter = &server.Router{}
+	tenantRouter.Route("GET", "/:who").Handler(func(stream *http.Stream) error {
+		return stream.EndString(stream.Params.ByName("subdomain") + " " + stream.Params.ByName("who"))
+	})
+
+	httpServer.SetRouter(defaultRouter)
+	httpServer.SetHostRouter("api.example.com", apiRouter)
+	httpServer.SetHostRouter("*.tenant.example.com", tenantRouter)
+
+	var get = func(host string) string {
+		req, _ := http3.NewRequest(http3.MethodGet, ts.URL+"/who", nil)
+		req.Host = host
+		response, err := ts.Client().Do(req)
+		assert.True(t, err == nil, err)
+		defer func() { _ = response.Body.Close() }()
+		bts, _ := ioutil.ReadAll(response.Body)
+		return string(bts)
+	}
+
+	assert.True(t, get("api.example.com:8080") == "api")
+	assert.True(t, get("a.b.tenant.example.com") == "a.b who")
+	assert.True(t, get("tenant.example.com") == "default")
+	assert.True(t, get("other.com") == "default")
+}
+
+func Test_Mount(t *testing.T) {
+
+	var httpServerRouter = &server.Router{}
+	httpServerRouter.Route("GET", "/std/own").Handler(func(stream *http.Stream) error {
+		return stream.EndString("own")
+	})
+	httpServerRouter.Mount("/std", http3.HandlerFunc(func(w http3.ResponseWriter, r *http3.Request) {
+		_, _ = w.Write([]byte(r.Method + " " + r.URL.Path))
+	}))
+
+	var subRouter = &server.Router{}
+	subRouter.Route("GET", "/users/:id").Handler(func(stream *http.Stream) error {
+		return stream.EndString(stream.Params.ByName("tenant") + " " + stream.Params.ByName("id"))
+	})
+	httpServerRouter.MountRouter("/tenants/:tenant", subRouter)
+
+	httpServerRouter.Mount("/adapter", server.HandlerFunc(func(stream *http.Stream) error {
+		return stream.EndString("adapter " + stream.Request.URL.Query().Get("a"))
+	}))
+
+	var sse = make(chan *http.SSE, 1)
+	httpServerRouter.Mount("/adapter-sse", server.HandlerFunc(func(stream *http.Stream) error {
+		var s, err = stream.SSE()
+		sse <- s
+		return err
+	}))
+	httpServerRouter.Mount("/adapter-error", server.HandlerFunc(func(stream *http.Stream) error {
+		_ = stream.EndString("partial")
+		return errors.New("late error")
+	}))
+	httpServerRouter.Mount("/adapter-panic", server.HandlerFunc(func(stream *http.Stream) error {
+		if stream.Request.URL.Query().Get("write") != "" {
+			_ = stream.EndString("partial")
+		}
+		panic("adapter panic")
+	}))
+
+	httpServer.SetRouter(httpServerRouter)
+
+	assert.True(t, Get(ts.URL+"/std/own").Query().Send().String() == "own")
+	assert.True(t, Get(ts.URL+"/std/debug/pprof").Query().Send().String() == "GET /debug/pprof")
+	assert.True(t, Post(ts.URL+"/std").Form().Send().String() == "POST /")
+	assert.True(t, Get(ts.URL+"/tenants/kitty/users/1").Query().Send().String() == "kitty 1")
+	assert.True(t, Get(ts.URL+"/tenants/kitty/none").Query().Send().Code() == 404)
+	assert.True(t, Get(ts.URL+"/adapter").Query(kitty.M{"a": 1}).Send().String() == "adapter 1")
+
+	// the sse is closed when the handler returns
+	_ = Get(ts.URL + "/adapter-sse").Query().Send()
+	assert.True(t, (<-sse).Send(http.Event{Data: "late"}) != nil)
+
+	// the status is not written after the body
+	var res = Get(ts.URL + "/adapter-error").Query().Send()
+	assert.True(t, res.Code() == 200 && res.String() == "partial", res.Code())
+
+	// a panic is a PanicError of the server
+	var ch = make(chan error, 1)
+	httpServer.OnError = func(stream *http.Stream, err error) { ch <- err }
+	defer func() { httpServer.OnError = nil }()
+
+	assert.True(t, Get(ts.URL+"/adapter-panic").Query().Send().Code() == 500)
+	var err, ok = (<-ch).(*kitty.PanicError)
+	assert.True(t, ok && err.Err == "adapter panic" && strings.Contains(err.Info, "client_test.go"), err)
+	res = Get(ts.URL + "/adapter-panic").Query(kitty.M{"write": 1}).Send()
+	assert.True(t, res.Code() == 200 && res.String() == "partial", res.Code())
+	_, ok = (<-ch).(*kitty.PanicError)
+	assert.True(t, ok)
+}
+
+func Test_Panic_Recover(t *testing.T) {
+
+	var httpServerRouter = &server.Router{}
+	httpServerRouter.Route("GET", "/panic").Handler(func(stream *http.Stream) error {
+		panic("route panic")
+	})
+
+	httpServer.SetRouter(httpServerRouter)
+
+	var ch = make(chan error, 1)
+	httpServer.OnError = func(stream *http.Stream, err error) { ch <- err }
+	defer func() { httpServer.OnError = nil }()
+
+	assert.True(t, Get(ts.URL+"/panic").Query().Send().Code() == 500)
+
+	var err, ok = (<-ch).(*kitty.PanicError)
+	assert.True(t, ok, err)
+	assert.True(t, err.Err == "route panic", err.Err)
+	assert.True(t, strings.Contains(err.Info, "client_test.go"), err.Info)
+	assert.True(t, len(err.Stack) > 0)
+}
+
+func Test_Server_Shutdown(t *testing.T) {
+
+	var started = make(chan struct{})
+
+	var srv = &server.Server{Addr: "127.0.0.1:8671"}
+	srv.OnSuccess = func() { close(started) }
+
+	var srvRouter = &server.Router{}
+	srvRouter.Route("GET", "/sleep").Handler(func(stream *http.Stream) error {
+		time.Sleep(200 * time.Millisecond)
+		return stream.EndString("done")
+	})
+
+	go srv.SetRouter(srvRouter).Start()
+	<-started
+
+	var res = make(chan string, 1)
+	go func() { res <- Get("http://127.0.0.1:8671/sleep").Query().Send().String() }()
+
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	report, err := srv.Shutdown(ctx)
+
+	assert.True(t, err == nil, err)
+	assert.True(t, report.Drained == 1 && report.Killed == 0, report)
+	assert.True(t, <-res == "done")
+}
+
+func Test_Server_Options(t *testing.T) {
+
+	var started = make(chan struct{})
+
+	var states = make(chan http3.ConnState, 8)
+
+	var srv = &server.Server{Addr: "127.0.0.1:8672", MaxHeaderBytes: 1024}
+	srv.OnSuccess = func() { close(started) }
+	srv.ConnState = func(conn net.Conn, state http3.ConnState) {
+		select {
+		case states <- state:
+		default:
+		}
+	}
+
+	var srvRouter = &server.Router{}
+	srvRouter.Route("GET", "/hello").Handler(func(stream *http.Stream) error {
+		return stream.EndString("hello")
+	})
+
+	go srv.SetRouter(srvRouter).Start()
+	<-started
+	defer func() { _, _ = srv.Shutdown(context.Background()) }()
+
+	// the limit is checked on a new connection
+	var res = Get("http://127.0.0.1:8672/hello").SetHeader("X-Large", strings.Repeat("a", 8192)).Query().Send()
+	assert.True(t, res.Code() == http3.StatusRequestHeaderFieldsTooLarge, res.Code())
+	assert.True(t, <-states == http3.StateNew)
+
+	assert.True(t, Get("http://127.0.0.1:8672/hello").Query().Send().String() == "hello")
+}
+
+func Test_Server_ReadTimeout(t *testing.T) {
+
+	var srv = &server.Server{Addr: "127.0.0.1:8676"}
+	srv.Ready()
+	assert.True(t, srv.ReadTimeout == 60*time.Second, srv.ReadTimeout)
+	assert.True(t, srv.WriteTimeout == 0, srv.WriteTimeout)
+
+	var started = make(chan struct{})
+
+	var errs = make(chan error, 1)
+
+	srv = &server.Server{Addr: "127.0.0.1:8676", ReadTimeout: 200 * time.Millisecond}
+	srv.OnSuccess = func() { close(started) }
+
+	var srvRouter = &server.Router{}
+	srvRouter.Route("POST", "/upload").Handler(func(stream *http.Stream) error {
+		_, err := ioutil.ReadAll(stream.Request.Body)
+		errs <- err
+		return nil
+	})
+
+	go srv.SetRouter(srvRouter).Start()
+	<-started
+	defer func() { _, _ = srv.Shutdown(context.Background()) }()
+
+	// the body stops after 5 of 10 bytes
+	conn, err := net.Dial("tcp", "127.0.0.1:8676")
+	assert.True(t, err == nil, err)
+	defer func() { _ = conn.Close() }()
+
+	_, err = conn.Write([]byte("POST /upload HTTP/1.1\r\nHost: 127.0.0.1\r\nContent-Length: 10\r\n\r\nhello"))
+	assert.True(t, err == nil, err)
+
+	select {
+	case err = <-errs:
+		assert.True(t, err != nil)
+	case <-time.After(2 * time.Second):
+		t.Fatal("slow body is not cut by ReadTimeout")
+	}
+}
+
+func Test_Server_H2C(t *testing.T) {
+
+	var started = make(chan struct{})
+
+	var srv = &server.Server{Addr: "127.0.0.1:8673", H2C: true, HTTP2: &http2.Server{MaxConcurrentStreams: 16}}
+	srv.OnSuccess = func() { close(started) }
+
+	var srvRouter = &server.Router{}
+	srvRouter.Route("GET", "/proto").Handler(func(stream *http.Stream) error {
+		return stream.EndString(stream.Request.Proto)
+	})
+
+	go srv.SetRouter(srvRouter).Start()
+	<-started
+	defer func() { _, _ = srv.Shutdown(context.Background()) }()
+
+	var h2Client = &http3.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+
+	response, err := h2Client.Get("http://127.0.0.1:8673/proto")
+	assert.True(t, err == nil, err)
+	defer func() { _ = response.Body.Close() }()
+	bts, _ := ioutil.ReadAll(response.Body)
+	assert.True(t, string(bts) == "HTTP/2.0", string(bts))
+
+	assert.True(t, Get("http://127.0.0.1:8673/proto").Query().Send().String() == "HTTP/1.1")
+}
+
+// newCert signs a certificate for name with ca, it is a self signed ca when ca is nil.
+func newCert(t *testing.T, name string, ca *x509.Certificate, caKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.True(t, err == nil, err)
+
+	var template = &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	if ca == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		ca, caKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	assert.True(t, err == nil, err)
+
+	cert, err := x509.ParseCertificate(der)
+	assert.True(t, err == nil, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.True(t, err == nil, err)
+
+	return cert, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func Test_Server_TLS(t *testing.T) {
+
+	var dir = t.TempDir()
+
+	var write = func(name string, bts []byte) string {
+		var file = filepath.Join(dir, name)
+		assert.True(t, ioutil.WriteFile(file, bts, 0600) == nil)
+		return file
+	}
+
+	ca, caKey, caPem, _ := newCert(t, "kitty-ca", nil, nil)
+	_, _, serverPem, serverKey := newCert(t, "server-1", ca, caKey)
+	_, _, wildcardPem, wildcardKey := newCert(t, "*.example.com", ca, caKey)
+	_, _, clientPem, clientKey := newCert(t, "kitty-client", ca, caKey)
+
+	var caFile = write("ca.pem", caPem)
+
+	var serverOptions = &kitty.TLSOptions{
+		CertFile:     write("server.pem", serverPem),
+		KeyFile:      write("server.key", serverKey),
+		ClientCAFile: caFile,
+		Certificates: map[string]kitty.KeyPair{
+			"*.example.com": {CertFile: write("wildcard.pem", wildcardPem), KeyFile: write("wildcard.key", wildcardKey)},
+		},
+	}
+
+	var started = make(chan struct{})
+
+	var srv = &server.Server{Addr: "127.0.0.1:8674", TLSOptions: serverOptions}
+	srv.OnSuccess = func() { close(started) }
+
+	var srvRouter = &server.Router{}
+	srvRouter.Route("GET", "/peer").Handler(func(stream *http.Stream) error {
+		return stream.EndString(stream.PeerCertificate().Subject.CommonName)
+	})
+
+	go srv.SetRouter(srvRouter).Start()
+	<-started
+	defer func() { _, _ = srv.Shutdown(context.Background()) }()
+
+	// get returns the name of the server certificate and the body
+	var get = func(options *kitty.TLSOptions) (string, string, error) {
+		config, err := options.ClientConfig("127.0.0.1:8674")
+		assert.True(t, err == nil, err)
+		var c = &http3.Client{Transport: &http3.Transport{TLSClientConfig: config}}
+		response, err := c.Get("https://127.0.0.1:8674/peer")
+		if err != nil {
+			return "", "", err
+		}
+		defer func() { _ = response.Body.Close() }()
+		bts, _ := ioutil.ReadAll(response.Body)
+		return response.TLS.PeerCertificates[0].Subject.CommonName, string(bts), nil
+	}
+
+	var clientOptions = &kitty.TLSOptions{
+		CertFile:   write("client.pem", clientPem),
+		KeyFile:    write("client.key", clientKey),
+		RootCAFile: caFile,
+	}
+
+	name, body, err := get(clientOptions)
+	assert.True(t, err == nil, err)
+	assert.True(t, name == "server-1", name)
+	assert.True(t, body == "kitty-client", body)
+
+	// sni
+	clientOptions.ServerName = "api.example.com"
+	name, _, err = get(clientOptions)
+	assert.True(t, err == nil, err)
+	assert.True(t, name == "*.example.com", name)
+	clientOptions.ServerName = ""
+
+	// without client certificate
+	_, _, err = get(&kitty.TLSOptions{RootCAFile: caFile})
+	assert.True(t, err != nil)
+
+	// reload
+	_, _, serverPem, serverKey = newCert(t, "server-2", ca, caKey)
+	write("server.pem", serverPem)
+	write("server.key", serverKey)
+	assert.True(t, serverOptions.Reload() == nil)
+
+	name, _, err = get(clientOptions)
+	assert.True(t, err == nil, err)
+	assert.True(t, name == "server-2", name)
+}
+
+func Test_TLS_Watch(t *testing.T) {
+
+	var dir = t.TempDir()
+
+	ca, caKey, _, _ := newCert(t, "kitty-ca", nil, nil)
+
+	var certFile, keyFile = filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key")
+
+	var modTime = time.Now()
+
+	// write changes the key pair and its time so the check sees it
+	var write = func(name string) {
+		_, _, certPem, keyPem := newCert(t, name, ca, caKey)
+		assert.True(t, ioutil.WriteFile(certFile, certPem, 0600) == nil)
+		assert.True(t, ioutil.WriteFile(keyFile, keyPem, 0600) == nil)
+		modTime = modTime.Add(time.Second)
+		assert.True(t, os.Chtimes(certFile, modTime, modTime) == nil)
+		assert.True(t, os.Chtimes(keyFile, modTime, modTime) == nil)
+	}
+
+	write("server-1")
+
+	var options = &kitty.TLSOptions{CertFile: certFile, KeyFile: keyFile, ReloadInterval: 10 * time.Millisecond}
+
+	// the second call must not start a second check
+	_, err := options.ServerConfig()
+	assert.True(t, err == nil, err)
+	config, err := options.ServerConfig()
+	assert.True(t, err == nil, err)
+
+	var name = func() string {
+		cert, err := config.GetCertificate(&tls.ClientHelloInfo{})
+		assert.True(t, err == nil, err)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		assert.True(t, err == nil, err)
+		return leaf.Subject.CommonName
+	}
+
+	assert.True(t, name() == "server-1")
+
+	write("server-2")
+	assert.Eventually(t, func() bool { return name() == "server-2" }, time.Second, 10*time.Millisecond)
+
+	options.Close()
+
+	write("server-3")
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, name() == "server-2", name())
+}
+
+func Test_Static_Content(t *testing.T) {
+
+	var dir = t.TempDir()
+
+	assert.True(t, ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello static content"), 0644) == nil)
+	assert.True(t, ioutil.WriteFile(filepath.Join(dir, "app.css"), []byte("body{}"), 0644) == nil)
+	assert.True(t, ioutil.WriteFile(filepath.Join(dir, ".env"), []byte("secret"), 0644) == nil)
+	assert.True(t, os.Mkdir(filepath.Join(dir, "sub"), 0755) == nil)
+	assert.True(t, ioutil.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("b"), 0644) == nil)
+
+	var httpServerRouter = &server.Router{}
+	httpServerRouter.SetStatic(&server.Static{
+		Prefix:       "/files",
+		Dir:          dir,
+		Listing:      true,
+		CacheControl: []server.CacheControl{{Ext: ".css", Value: "max-age=60"}},
+	})
+	httpServerRouter.SetStatic(&server.Static{Prefix: "/strong", Dir: dir, StrongETag: true})
+	httpServer.SetRouter(httpServerRouter)
+
+	// range
+	var res = Get(ts.URL+"/files/a.txt").SetHeader("Range", "bytes=0-4").Query().Send()
+	assert.True(t, res.Code() == http3.StatusPartialContent, res.Code())
+	assert.True(t, res.String() == "hello", res.String())
+
+	// conditional
+	res = Get(ts.URL + "/files/a.txt").Query().Send()
+	var tag = res.Response().Header.Get("ETag")
+	assert.True(t, strings.HasPrefix(tag, `W/"`), tag)
+	assert.True(t, res.Response().Header.Get("Last-Modified") != "")
+	res = Get(ts.URL+"/files/a.txt").SetHeader("If-None-Match", tag).Query().Send()
+	assert.True(t, res.Code() == http3.StatusNotModified, res.Code())
+	res = Get(ts.URL+"/files/a.txt").SetHeader("If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http3.TimeFormat)).Query().Send()
+	assert.True(t, res.Code() == http3.StatusNotModified, res.Code())
+
+	res = Get(ts.URL + "/strong/a.txt").Query().Send()
+	tag = res.Response().Header.Get("ETag")
+	assert.True(t, strings.HasPrefix(tag, `"`), tag)
+	res = Get(ts.URL+"/strong/a.txt").SetHeader("If-None-Match", tag).Query().Send()
+	assert.True(t, res.Code() == http3.StatusNotModified, res.Code())
+
+	// cache control
+	res = Get(ts.URL + "/files/app.css").Query().Send()
+	assert.True(t, res.Response().Header.Get("Cache-Control") == "max-age=60")
+
+	// hidden and traversal
+	assert.True(t, Get(ts.URL+"/files/.env").Query().Send().Code() == http3.StatusNotFound)
+	assert.True(t, Get(ts.URL+"/files/../../../go.mod").Query().Send().Code() == http3.StatusNotFound)
+
+	// listing, the redirect adds the slash
+	res = Get(ts.URL + "/files/sub").Query().Send()
+	assert.True(t, res.Code() == http3.StatusOK, res.Code())
+	assert.True(t, strings.Contains(res.String(), `<a href="b.txt">b.txt</a>`), res.String())
+	assert.True(t, !strings.Contains(Get(ts.URL+"/files/").Query().Send().String(), ".env"))
+}
+
+func Test_Static_FS(t *testing.T) {
+
+	var fsys = fstest.MapFS{
+		"index.html":  {Data: []byte("<html>app</html>")},
+		"app.js":      {Data: []byte("console.log(1)")},
+		"app.js.gz":   {Data: []byte("gzip bytes")},
+		"app.js.br":   {Data: []byte("br bytes")},
+		"plain.js":    {Data: []byte("plain")},
+		"logo.svg.gz": {Data: []byte("only gzip")},
+		"v1.js":       {Data: []byte("one")},
+		"v2.js":       {Data: []byte("two")},
+	}
+
+	var httpServerRouter = &server.Router{}
+	httpServerRouter.SetStatic(&server.Static{Prefix: "/app", FS: fsys, Precompressed: true, Fallback: "index.html"})
+	httpServerRouter.SetStaticFS("/raw", fsys)
+	httpServerRouter.Group("/app/api").Handler(func(handler *server.RouteHandler) {
+		handler.Get("/ping").Handler(func(stream *http.Stream) error {
+			return stream.EndString("pong")
+		})
+	})
+	httpServer.SetRouter(httpServerRouter)
+
+	// fs
+	var res = Get(ts.URL + "/raw/plain.js").Query().Send()
+	assert.True(t, res.String() == "plain", res.String())
+
+	// no modtime, the same size, the content is hashed
+	var tag1 = Get(ts.URL + "/raw/v1.js").Query().Send().Response().Header.Get("ETag")
+	var tag2 = Get(ts.URL + "/raw/v2.js").Query().Send().Response().Header.Get("ETag")
+	assert.True(t, strings.HasPrefix(tag1, `"`) && tag1 != tag2, tag1, tag2)
+	assert.True(t, Get(ts.URL+"/raw/v1.js").Query().Send().Response().Header.Get("Last-Modified") == "")
+
+	// precompressed, br first
+	res = Get(ts.URL+"/app/app.js").SetHeader("Accept-Encoding", "gzip, br").Query().Send()
+	assert.True(t, res.Response().Header.Get("Content-Encoding") == "br")
+	assert.True(t, res.Response().Header.Get("Vary") == "Accept-Encoding")
+	assert.True(t, strings.Contains(res.Response().Header.Get("Content-Type"), "javascript"), res.Response().Header.Get("Content-Type"))
+	assert.True(t, res.String() == "br bytes", res.String())
+
+	res = Get(ts.URL+"/app/app.js").SetHeader("Accept-Encoding", "gzip, br;q=0").Query().Send()
+	assert.True(t, res.Response().Header.Get("Content-Encoding") == "gzip")
+	assert.True(t, res.String() == "gzip bytes", res.String())
+
+	res = Get(ts.URL+"/app/app.js").SetHeader("Accept-Encoding", "identity").Query().Send()
+	assert.True(t, res.Response().Header.Get("Content-Encoding") == "")
+	assert.True(t, res.Response().Header.Get("Vary") == "Accept-Encoding")
+	assert.True(t, res.String() == "console.log(1)", res.String())
+
+	// no file without the sibling
+	assert.True(t, Get(ts.URL+"/app/logo.svg").SetHeader("Accept-Encoding", "gzip").Query().Send().Code() == http3.StatusNotFound)
+
+	// fallback, the routes keep priority
+	res = Get(ts.URL+"/app/users/1").SetHeader("Accept", "text/html").Query().Send()
+	assert.True(t, res.Code() == http3.StatusOK, res.Code())
+	assert.True(t, res.String() == "<html>app</html>", res.String())
+
+	res = Get(ts.URL+"/app/api/ping").SetHeader("Accept", "text/html").Query().Send()
+	assert.True(t, res.String() == "pong", res.String())
+
+	assert.True(t, Get(ts.URL+"/app/missing.js").SetHeader("Accept", "text/html").Query().Send().Code() == http3.StatusNotFound)
+	assert.True(t, Get(ts.URL+"/app/api/none").SetHeader("Accept", "application/json").Query().Send().Code() == http3.StatusNotFound)
+	assert.True(t, Get(ts.URL+"/raw/users/1").SetHeader("Accept", "text/html").Query().Send().Code() == http3.StatusNotFound)
+}
+
+// hijackHandler answers on the connection, like the upgrade of a websocket.
+func hijackHandler(stream *http.Stream) error {
+	hijacker, ok := stream.Response.(http3.Hijacker)
+	if !ok {
+		return errors.New("response can not be hijacked")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	_, _ = rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+	return rw.Flush()
+}
+
+func Test_Compress(t *testing.T) {
+
+	var srv = &server.Server{}
+	var compressTS = httptest.NewServer(srv)
+	defer compressTS.Close()
+
+	var compress = &server.Compress{MaxBodySize: 1024}
+	srv.Use(compress.Middleware, func(next server.Middle) server.Middle {
+		return func(stream *http.Stream) {
+			stream.AutoParse()
+			next(stream)
+		}
+	})
+
+	var big = strings.Repeat("hello compress ", 100)
+
+	var srvRouter = &server.Router{}
+	srvRouter.Route("GET", "/big").Handler(func(stream *http.Stream) error {
+		return stream.EndString(big)
+	})
+	srvRouter.Route("GET", "/small").Handler(func(stream *http.Stream) error {
+		return stream.EndString("small")
+	})
+	srvRouter.Route("GET", "/png").Handler(func(stream *http.Stream) error {
+		stream.SetHeader("Content-Type", "image/png")
+		return stream.EndString(big)
+	})
+	srvRouter.Route("GET", "/stream").Handler(func(stream *http.Stream) error {
+		_ = stream.EndString("a")
+		stream.Response.(http3.Flusher).Flush()
+		return stream.EndString("b")
+	})
+	srvRouter.Route("POST", "/json").Handler(func(stream *http.Stream) error {
+		return stream.EndString(stream.Json.Get("a").String())
+	})
+	srvRouter.Route("GET", "/hijack").Handler(hijackHandler)
+	srvRouter.Route("POST", "/body").Handler(func(stream *http.Stream) error {
+		if _, err := ioutil.ReadAll(stream.Request.Body); err != nil {
+			return stream.EndString("too large")
+		}
+		return stream.EndString("ok")
+	})
+	srv.SetRouter(srvRouter)
+
+	var gunzip = func(bts []byte) string {
+		reader, err := gzip.NewReader(bytes.NewReader(bts))
+		assert.True(t, err == nil, err)
+		res, _ := ioutil.ReadAll(reader)
+		return string(res)
+	}
+
+	var res = Get(compressTS.URL+"/big").SetHeader("Accept-Encoding", "gzip").Query().Send()
+	assert.True(t, res.Response().Header.Get("Content-Encoding") == "gzip")
+	assert.True(t, res.Response().Header.Get("Vary") == "Accept-Encoding")
+	assert.True(t, strings.HasPrefix(res.Response().Header.Get("Content-Type"), "text/plain"))
+	assert.True(t, gunzip(res.Bytes()) == big)
+
+	res = Get(compressTS.URL+"/big").SetHeader("Accept-Encoding", "gzip;q=0.5, deflate").Query().Send()
+	assert.True(t, res.Response().Header.Get("Content-Encoding") == "deflate")
+
+	res = Get(compressTS.URL+"/big").SetHeader("Accept-Encoding", "br").Query().Send()
+	assert.True(t, res.Response().Header.Get("Content-Encoding") == "")
+	assert.True(t, res.String() == big)
+
+	// small and compressed bodies
+	res = Get(compressTS.URL+"/small").SetHeader("Accept-Encoding", "gzip").Query().Send()
+	assert.True(t, res.Response().Header.Get("Content-Encoding") == "" && res.String() == "small")
+	res = Get(compressTS.URL+"/png").SetHeader("Accept-Encoding", "gzip").Query().Send()
+	assert.True(t, res.Response().Header.Get("Content-Encoding") == "" && res.String() == big)
+
+	// the connection of an upgrade
+	res = Get(compressTS.URL+"/hijack").SetHeader("Accept-Encoding", "gzip").Query().Send()
+	assert.True(t, res.String() == "hijacked", res.String())
+
+	// flushed bodies are encoded
+	res = Get(compressTS.URL+"/stream").SetHeader("Accept-Encoding", "gzip").Query().Send()
+	assert.True(t, res.Response().Header.Get("Content-Encoding") == "gzip")
+	assert.True(t, gunzip(res.Bytes()) == "ab")
+
+	// request bodies
+	var gzipBody = func(bts []byte) *bytes.Buffer {
+		var buf = new(bytes.Buffer)
+		var writer = gzip.NewWriter(buf)
+		_, _ = writer.Write(bts)
+		_ = writer.Close()
+		return buf
+	}
+
+	var post = func(path string, encoding string, body *bytes.Buffer) (int, string) {
+		request, _ := http3.NewRequest("POST", compressTS.URL+path, body)
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Content-Encoding", encoding)
+		response, err := http3.DefaultClient.Do(request)
+		assert.True(t, err == nil, err)
+		defer func() { _ = response.Body.Close() }()
+		bts, _ := ioutil.ReadAll(response.Body)
+		return response.StatusCode, string(bts)
+	}
+
+	var code, body = post("/json", "gzip", gzipBody([]byte(`{"a":"decoded"}`)))
+	assert.True(t, code == http3.StatusOK && body == "decoded", body)
+
+	code, body = post("/body", "gzip", gzipBody(make([]byte, 4096)))
+	assert.True(t, body == "too large", body)
+
+	code, _ = post("/json", "zstd", bytes.NewBufferString("{}"))
+	assert.True(t, code == http3.StatusUnsupportedMediaType, code)
+
+	code, _ = post("/json", "gzip", bytes.NewBufferString("not gzip"))
+	assert.True(t, code == http3.StatusBadRequest, code)
+}
+
+func Test_Server_Inherit(t *testing.T) {
+
+	// the child process, it serves on the inherited listener
+	if addr := os.Getenv("KITTY_TEST_INHERIT"); addr != "" {
+		var srv = &server.Server{Addr: addr}
+		var srvRouter = &server.Router{}
+		srvRouter.Route("GET", "/pid").Handler(func(stream *http.Stream) error {
+			return stream.EndString(strconv.Itoa(os.Getpid()))
+		})
+		time.AfterFunc(5*time.Second, func() { os.Exit(0) })
+		srv.SetRouter(srvRouter).Start()
+		return
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.True(t, err == nil, err)
+	file, err := listener.(*net.TCPListener).File()
+	assert.True(t, err == nil, err)
+
+	var addr = listener.Addr().String()
+
+	var cmd = exec.Command(os.Args[0], "-test.run=^Test_Server_Inherit$")
+	cmd.Env = append(os.Environ(), "KITTY_TEST_INHERIT="+addr, "LISTEN_FDS=1")
+	cmd.ExtraFiles = []*os.File{file}
+	assert.True(t, cmd.Start() == nil)
+	defer func() { _ = cmd.Process.Kill(); _ = cmd.Wait() }()
+
+	// the socket is kept by the child
+	_ = file.Close()
+	_ = listener.Close()
+
+	var pid string
+	for i := 0; i < 50 && pid == ""; i++ {
+		response, err := http3.Get("http://" + addr + "/pid")
+		if err != nil {
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		bts, _ := ioutil.ReadAll(response.Body)
+		_ = response.Body.Close()
+		pid = string(bts)
+	}
+
+	assert.True(t, pid == strconv.Itoa(cmd.Process.Pid), pid)
+}
+
+func Test_Server_Restart(t *testing.T) {
+
+	// the helper process, the old one restarts and drains,
+	// the new one serves on the listener it inherits from Restart
+	if addr := os.Getenv("KITTY_TEST_RESTART"); addr != "" {
+
+		var isNew = os.Getenv("LISTEN_FDS") != ""
+
+		var srv = &server.Server{Addr: addr}
+		var done = make(chan struct{})
+
+		var srvRouter = &server.Router{}
+		srvRouter.Route("GET", "/pid").Handler(func(stream *http.Stream) error {
+			return stream.EndString(strconv.Itoa(os.Getpid()))
+		})
+		srvRouter.Route("GET", "/slow").Handler(func(stream *http.Stream) error {
+			time.Sleep(2 * time.Second)
+			return stream.EndString(strconv.Itoa(os.Getpid()))
+		})
+		srvRouter.Route("GET", "/restart").Handler(func(stream *http.Stream) error {
+			process, err := kitty.Restart()
+			if err != nil {
+				return err
+			}
+			go func() {
+				_, _ = srv.Shutdown(context.Background())
+				close(done)
+			}()
+			return stream.EndString(strconv.Itoa(process.Pid))
+		})
+
+		time.AfterFunc(10*time.Second, func() { os.Exit(0) })
+
+		go srv.SetRouter(srvRouter).Start()
+
+		if isNew {
+			select {}
+		}
+
+		<-done
+		return
+	}
+
+	var addr = "127.0.0.1:8677"
+
+	var cmd = exec.Command(os.Args[0], "-test.run=^Test_Server_Restart$")
+	cmd.Env = append(os.Environ(), "KITTY_TEST_RESTART="+addr)
+	assert.True(t, cmd.Start() == nil)
+	defer func() { _ = cmd.Process.Kill(); _ = cmd.Wait() }()
+
+	// a new connection for every request
+	var c = &http3.Client{Transport: &http3.Transport{DisableKeepAlives: true}}
+
+	var get = func(path string) string {
+		response, err := c.Get("http://" + addr + path)
+		if err != nil {
+			return ""
+		}
+		defer func() { _ = response.Body.Close() }()
+		bts, _ := ioutil.ReadAll(response.Body)
+		return string(bts)
+	}
+
+	var oldPid = strconv.Itoa(cmd.Process.Pid)
+
+	var pid string
+	for i := 0; i < 50 && pid == ""; i++ {
+		if pid = get("/pid"); pid == "" {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	assert.True(t, pid == oldPid, pid)
+
+	var slow = make(chan string, 1)
+	go func() { slow <- get("/slow") }()
+	time.Sleep(100 * time.Millisecond)
+
+	var newPid = get("/restart")
+	assert.True(t, newPid != "" && newPid != oldPid, newPid)
+
+	defer func() {
+		if n, err := strconv.Atoi(newPid); err == nil {
+			if process, err := os.FindProcess(n); err == nil {
+				_ = process.Kill()
+			}
+		}
+	}()
+
+	// the new process accepts while the old one drains
+	for i := 0; i < 50 && pid != newPid; i++ {
+		if pid = get("/pid"); pid != newPid {
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+	assert.True(t, pid == newPid, pid)
+
+	select {
+	case res := <-slow:
+		t.Fatal("slow request ended before the new process accepted", res)
+	default:
+	}
+
+	assert.True(t, <-slow == oldPid)
+
+	var exited = make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	select {
+	case err := <-exited:
+		assert.True(t, err == nil, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("old process does not exit after drain")
+	}
+
+	// the listener is still open after the old process exits
+	assert.True(t, get("/pid") == newPid)
+}
+
+type bindUser struct {
+	Name string `json:"name" form:"name"`
+}
+
+type bindRequest struct {
+	ID     int                   `path:"id"`
+	Page   *int                  `query:"page"`
+	Tags   []string              `query:"tag"`
+	Since  time.Time             `query:"since" layout:"2006-01-02"`
+	At     time.Time             `query:"at"`
+	TTL    time.Duration         `query:"ttl"`
+	On     bool                  `query:"on"`
+	Token  string                `header:"X-Token"`
+	IP     net.IP                `header:"X-IP"`
+	Avatar *multipart.FileHeader `form:"avatar"`
+	User   bindUser
+	Age    int `json:"age"`
+}
+
+func Test_Bind(t *testing.T) {
+
+	var httpServerRouter = &server.Router{}
+
+	var bound = make(chan *bindRequest, 1)
+	var bindErr = make(chan error, 1)
+
+	httpServerRouter.Route("POST", "/bind/:id").Handler(func(stream *http.Stream) error {
+		var req bindRequest
+		bindErr <- stream.Bind(&req)
+		bound <- &req
+		return stream.EndString("ok")
+	})
+
+	httpServer.SetRouter(httpServerRouter)
+
+	var file, err = os.Open("../../example/server/public/test.txt")
+	assert.True(t, err == nil, err)
+	defer func() { _ = file.Close() }()
+
+	Post(ts.URL+"/bind/7?page=2&tag=a&tag=b&since=2021-07-01&at=2021-07-01T10:00:00Z&ttl=1m&on=on").
+		SetHeader("X-Token", "token").
+		SetHeader("X-IP", "127.0.0.1").
+		Multipart(kitty.M{"name": "lemo", "avatar": file}).Send()
+
+	assert.True(t, <-bindErr == nil)
+	var req = <-bound
+	assert.True(t, req.ID == 7 && req.Page != nil && *req.Page == 2, req)
+	assert.True(t, len(req.Tags) == 2 && req.Tags[1] == "b", req.Tags)
+	assert.True(t, req.Since.Equal(time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC)), req.Since)
+	assert.True(t, req.At.Hour() == 10, req.At)
+	assert.True(t, req.TTL == time.Minute && req.On, req)
+	assert.True(t, req.Token == "token" && req.IP.Equal(net.IPv4(127, 0, 0, 1)), req)
+	assert.True(t, req.Avatar != nil && req.Avatar.Size == 13, req.Avatar)
+	assert.True(t, req.User.Name == "lemo", req.User)
+
+	// json
+	Post(ts.URL + "/bind/8").Json(struct {
+		Age int `json:"age"`
+	}{3}).Send()
+	assert.True(t, <-bindErr == nil)
+	req = <-bound
+	assert.True(t, req.ID == 8 && req.Age == 3, req)
+
+	// every failed field
+	Post(ts.URL + "/bind/x?page=a&ttl=1").Json(struct {
+		Age string `json:"age"`
+	}{"3"}).Send()
+	var e *http.BindError
+	assert.True(t, errors.As(<-bindErr, &e))
+	<-bound
+	assert.True(t, len(e.Fields) == 4, e)
+	assert.True(t, e.Fields[0].Source == "json" && e.Fields[0].Field == "Age" && e.Fields[0].Key == "age", e.Fields[0])
+	assert.True(t, e.Fields[1].Field == "ID" && e.Fields[1].Source == "path" && e.Fields[1].Value == "x", e.Fields[1])
+	assert.True(t, e.Fields[2].Field == "Page" && e.Fields[3].Field == "TTL", e)
+
+	// the go names of a nested json key
+	Post(ts.URL + "/bind/9").Json(kitty.M{"User": kitty.M{"name": 1}}).Send()
+	assert.True(t, errors.As(<-bindErr, &e))
+	<-bound
+	assert.True(t, len(e.Fields) == 1 && e.Fields[0].Field == "User.Name" && e.Fields[0].Key == "User.name", e.Fields[0])
+}
+
+func Test_Store_Struct(t *testing.T) {
+
+	var store = &http.Store{}
+	store.Add("ok", []string{"true"})
+	store.Add("n", []string{"1", "2"})
+	store.Add("bad", []string{"x"})
+
+	var input struct {
+		OK  bool    `json:"ok"`
+		N   []int32 `json:"n,omitempty"`
+		Bad int     `json:"bad"`
+	}
+
+	var err = store.Struct(&input)
+	assert.True(t, input.OK && len(input.N) == 2 && input.N[1] == 2, input)
+
+	var e *http.BindError
+	assert.True(t, errors.As(err, &e) && len(e.Fields) == 1 && e.Fields[0].Key == "bad", err)
+}
+
+func Test_Bind_Validate(t *testing.T) {
+
+	var httpServerRouter = &server.Router{}
+
+	httpServerRouter.Route("POST", "/validate").Handler(func(stream *http.Stream) error {
+		var req struct {
+			Name string `form:"name" validate:"required,max=4"`
+			Page int    `query:"page" validate:"min=1"`
+		}
+		if err := stream.Bind(&req); err != nil {
+			return stream.JsonInvalid(err)
+		}
+		return stream.EndString("ok")
+	})
+
+	httpServer.SetRouter(httpServerRouter)
+
+	assert.True(t, Post(ts.URL+"/validate?page=1").Form(kitty.M{"name": "lemo"}).Send().String() == "ok")
+
+	var res = Post(ts.URL + "/validate?page=0").Form(kitty.M{"name": "kitty"}).Send()
+	assert.True(t, res.Code() == http3.StatusUnprocessableEntity, res.Code())
+	assert.True(t, res.Response().Header.Get("Content-Type") == "application/json")
+	assert.True(t, res.String() == `{"status":"ERROR","code":422,"msg":{"fields":[`+
+		`{"field":"Name","key":"name","rule":"max","param":"4","message":"must be at most 4"},`+
+		`{"field":"Page","key":"page","rule":"min","param":"1","message":"must be at least 1"}]}}`, res.String())
+
+	// bind errors come first
+	res = Post(ts.URL + "/validate?page=a").Form(kitty.M{"name": "lemo"}).Send()
+	assert.True(t, res.Code() == http3.StatusUnprocessableEntity, res.Code())
+	assert.True(t, strings.Contains(res.String(), `"source":"query","key":"page","value":"a","message":"strconv.ParseInt`), res.String())
+}
+
+type renderUser struct {
+	XMLName xml.Name `json:"-" xml:"user" msgpack:"-"`
+	Name    string   `json:"name" xml:"name" msgpack:"name"`
+}
+
+func Test_Render(t *testing.T) {
+
+	var httpServerRouter = &server.Router{}
+
+	httpServerRouter.Route("GET", "/render").Handler(func(stream *http.Stream) error {
+		return stream.Render(http3.StatusCreated, renderUser{Name: "lemo"})
+	})
+
+	httpServerRouter.Route("GET", "/render/proto").Handler(func(stream *http.Stream) error {
+		return stream.Render(http3.StatusOK, &awesomepackage.AwesomeMessage{AwesomeField: "lemo"})
+	})
+
+	httpServerRouter.Route("POST", "/render/bind").Handler(func(stream *http.Stream) error {
+		var user renderUser
+		if err := stream.Bind(&user); err != nil {
+			return stream.JsonInvalid(err)
+		}
+		return stream.EndString(user.Name)
+	})
+
+	httpServer.SetRouter(httpServerRouter)
+
+	var res = Get(ts.URL + "/render").Query().Send()
+	assert.True(t, res.Code() == http3.StatusCreated, res.Code())
+	assert.True(t, res.Response().Header.Get("Content-Type") == "application/json")
+	assert.True(t, res.String() == `{"name":"lemo"}`, res.String())
+
+	res = Get(ts.URL+"/render").SetHeader("Accept", "text/plain;q=0.5, application/xml;q=0.9").Query().Send()
+	assert.True(t, res.Response().Header.Get("Content-Type") == "application/xml")
+	assert.True(t, res.String() == `<user><name>lemo</name></user>`, res.String())
+
+	res = Get(ts.URL+"/render").SetHeader("Accept", "application/msgpack").Query().Send()
+	var user renderUser
+	assert.True(t, msgpack.Unmarshal(res.Bytes(), &user) == nil && user.Name == "lemo", user)
+
+	// protobuf needs a proto.Message
+	assert.True(t, Get(ts.URL+"/render").SetHeader("Accept", "application/x-protobuf").Query().Send().Code() == http3.StatusNotAcceptable)
+	res = Get(ts.URL+"/render/proto").SetHeader("Accept", "application/x-protobuf").Query().Send()
+	var msg awesomepackage.AwesomeMessage
+	assert.True(t, proto.Unmarshal(res.Bytes(), &msg) == nil && msg.AwesomeField == "lemo", res.Code())
+
+	assert.True(t, Get(ts.URL+"/render").SetHeader("Accept", "image/png").Query().Send().Code() == http3.StatusNotAcceptable)
+
+	// a custom renderer
+	http.SetRenderer("text/csv", func(v interface{}) ([]byte, error) {
+		if u, ok := v.(renderUser); ok {
+			return []byte("name\n" + u.Name + "\n"), nil
+		}
+		return nil, http.ErrUnsupported
+	})
+	res = Get(ts.URL+"/render").SetHeader("Accept", "text/csv").Query().Send()
+	assert.True(t, res.Response().Header.Get("Content-Type") == "text/csv; charset=utf-8")
+	assert.True(t, res.String() == "name\nlemo\n", res.String())
+
+	// the decoders of bind
+	var post = func(contentType string, body []byte) string {
+		response, err := http3.Post(ts.URL+"/render/bind", contentType, bytes.NewReader(body))
+		assert.True(t, err == nil, err)
+		defer func() { _ = response.Body.Close() }()
+		bts, _ := ioutil.ReadAll(response.Body)
+		return string(bts)
+	}
+
+	assert.True(t, post("application/xml", []byte(`<user><name>xml</name></user>`)) == "xml")
+	bts, _ := msgpack.Marshal(renderUser{Name: "msgpack"})
+	assert.True(t, post("application/msgpack", bts) == "msgpack")
+	var xmlErr = post("application/xml", []byte(`<user>`))
+	assert.True(t, strings.Contains(xmlErr, `"source":"xml"`) && strings.Contains(xmlErr, `"field":""`), xmlErr)
+}
+
+func Test_SetRenderer_Race(t *testing.T) {
+
+	var httpServerRouter = &server.Router{}
+
+	httpServerRouter.Route("GET", "/render/race").Handler(func(stream *http.Stream) error {
+		return stream.Render(http3.StatusOK, renderUser{Name: "lemo"})
+	})
+
+	httpServer.SetRouter(httpServerRouter)
+
+	var render = func(v interface{}) ([]byte, error) {
+		return []byte("race"), nil
+	}
+
+	http.SetRenderer("text/x-race", render)
+
+	var stop = make(chan struct{})
+	var done = make(chan struct{})
+
+	// a renderer is set while the requests render
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				http.SetRenderer("text/x-race", render)
+			}
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		var res = Get(ts.URL+"/render/race").SetHeader("Accept", "text/x-race").Query().Send()
+		assert.True(t, res.String() == "race", res.String())
+	}
+
+	close(stop)
+	<-done
+}
+
+func Test_ProtoBuf(t *testing.T) {
+
+	var httpServerRouter = &server.Router{}
+
+	httpServerRouter.Route("POST", "/protobuf").Handler(func(stream *http.Stream) error {
+		var msg awesomepackage.AwesomeMessage
+		if err := stream.ParseProtoBuf(&msg); err != nil {
+			return err
+		}
+		// the body is read once
+		var again awesomepackage.AwesomeMessage
+		if err := stream.ParseProtoBuf(&again); err != nil {
+			return err
+		}
+		return stream.EndProtoBuf(&awesomepackage.AwesomeMessage{AwesomeField: msg.AwesomeField, AwesomeKey: again.AwesomeKey})
+	})
+
+	httpServer.SetRouter(httpServerRouter)
+
+	var res = Post(ts.URL + "/protobuf").ProtoBuf(&awesomepackage.AwesomeMessage{AwesomeField: "hello", AwesomeKey: "key"}).Send()
+	assert.True(t, res.Response().Header.Get("Content-Type") == kitty.ApplicationProtoBuf)
+
+	var reply awesomepackage.AwesomeMessage
+	assert.True(t, res.ProtoBuf(&reply) == nil)
+	assert.True(t, reply.AwesomeField == "hello" && reply.AwesomeKey == "key", reply.String())
+}
+
+func Test_SSE(t *testing.T) {
+
+	var httpServerRouter = &server.Router{}
+
+	var gone = make(chan struct{})
+
+	httpServerRouter.Route("GET", "/sse").Handler(func(stream *http.Stream) error {
+		sse, err := stream.SSE()
+		if err != nil {
+			return err
+		}
+
+		sse.KeepAlive(30 * time.Millisecond)
+
+		_ = sse.Send(http.Event{ID: "1", Event: "hello", Data: "a\nb", Retry: time.Second})
+		time.Sleep(80 * time.Millisecond)
+		return sse.Send(http.Event{Data: "last " + sse.LastEventID})
+	})
+
+	httpServerRouter.Route("GET", "/sse/forever").Handler(func(stream *http.Stream) error {
+		sse, err := stream.SSE()
+		if err != nil {
+			return err
+		}
+		for {
+			select {
+			case <-sse.Done():
+				close(gone)
+				return nil
+			case <-time.After(10 * time.Millisecond):
+				_ = sse.Send(http.Event{Data: "tick"})
+			}
+		}
+	})
+
+	var left = make(chan *http.SSE, 1)
+
+	httpServerRouter.Route("GET", "/sse/left").Handler(func(stream *http.Stream) error {
+		sse, err := stream.SSE()
+		if err != nil {
+			return err
+		}
+		sse.KeepAlive(time.Millisecond)
+		left <- sse
+		return nil
+	})
+
+	httpServer.SetRouter(httpServerRouter)
+
+	// the server closes the sse when the handler returns
+	_ = Get(ts.URL + "/sse/left").Query().Send()
+	assert.True(t, (<-left).Send(http.Event{Data: "late"}) != nil)
+
+	var res = Get(ts.URL+"/sse").SetHeader("Last-Event-ID", "0").Query().Send()
+	assert.True(t, res.Response().Header.Get("Content-Type") == "text/event-stream")
+	assert.True(t, res.Response().Header.Get("Cache-Control") == "no-cache")
+	assert.True(t, strings.HasPrefix(res.String(), "id: 1\nevent: hello\nretry: 1000\ndata: a\ndata: b\n\n: ping\n\n"), res.String())
+	assert.True(t, strings.HasSuffix(res.String(), "data: last 0\n\n"), res.String())
+
+	// the handler stops when the client is gone
+	var ctx, cancel = context.WithCancel(context.Background())
+	request, _ := http3.NewRequestWithContext(ctx, "GET", ts.URL+"/sse/forever", nil)
+	response, err := http3.DefaultClient.Do(request)
+	assert.True(t, err == nil, err)
+	var line = make([]byte, 11)
+	_, err = io.ReadFull(response.Body, line)
+	assert.True(t, err == nil && string(line) == "data: tick\n", string(line))
+	cancel()
+	_ = response.Body.Close()
+
+	select {
+	case <-gone:
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func Test_Stream_Large_Body(t *testing.T) {
+
+	var dir = t.TempDir()
+	var path = filepath.Join(dir, "résumé.csv")
+	assert.True(t, ioutil.WriteFile(path, []byte("a,b\n1,2\n"), 0644) == nil)
+
+	var httpServerRouter = &server.Router{}
+
+	httpServerRouter.Route("GET", "/reader").Handler(func(stream *http.Stream) error {
+		return stream.EndReader(strings.NewReader("hello reader"), 12)
+	})
+
+	httpServerRouter.Route("GET", "/chunked").Handler(func(stream *http.Stream) error {
+		var writer = csv.NewWriter(stream)
+		for i := 0; i < 3; i++ {
+			_ = writer.Write([]string{strconv.Itoa(i), "row"})
+			writer.Flush()
+			if err := stream.Flush(); err != nil {
+				return err
+			}
+		}
+		return writer.Error()
+	})
+
+	httpServerRouter.Route("GET", "/disk").Handler(func(stream *http.Stream) error {
+		return stream.EndFileFromDisk(path)
+	})
+
+	httpServerRouter.Route("GET", "/missing").Handler(func(stream *http.Stream) error {
+		return stream.EndFileFromDisk(filepath.Join(dir, "missing.csv"))
+	})
+
+	httpServer.SetRouter(httpServerRouter)
+
+	var res = Get(ts.URL + "/reader").Query().Send()
+	assert.True(t, res.String() == "hello reader" && res.Response().ContentLength == 12, res.Response().ContentLength)
+
+	res = Get(ts.URL + "/chunked").Query().Send()
+	assert.True(t, res.String() == "0,row\n1,row\n2,row\n", res.String())
+	assert.True(t, len(res.Response().TransferEncoding) == 1 && res.Response().TransferEncoding[0] == "chunked")
+
+	res = Get(ts.URL + "/disk").Query().Send()
+	assert.True(t, res.String() == "a,b\n1,2\n", res.String())
+	assert.True(t, res.Response().Header.Get("Content-Disposition") == `attachment; filename="r_sum_.csv"; filename*=UTF-8''r%C3%A9sum%C3%A9.csv`, res.Response().Header.Get("Content-Disposition"))
+
+	// resume the download
+	var tag = res.Response().Header.Get("ETag")
+	res = Get(ts.URL+"/disk").SetHeader("Range", "bytes=4-").SetHeader("If-Range", res.Response().Header.Get("Last-Modified")).Query().Send()
+	assert.True(t, res.Code() == http3.StatusPartialContent && res.String() == "1,2\n", res.Code())
+	res = Get(ts.URL+"/disk").SetHeader("Range", "bytes=4-").SetHeader("If-Range", tag).Query().Send()
+	assert.True(t, res.Code() == http3.StatusPartialContent && res.String() == "1,2\n", res.Code())
+	res = Get(ts.URL+"/disk").SetHeader("Range", "bytes=4-").SetHeader("If-Range", `"other"`).Query().Send()
+	assert.True(t, res.Code() == http3.StatusOK, res.Code())
+	res = Get(ts.URL+"/disk").SetHeader("If-None-Match", tag).Query().Send()
+	assert.True(t, res.Code() == http3.StatusNotModified, res.Code())
+
+	assert.True(t, Get(ts.URL+"/missing").Query().Send().Code() == http3.StatusNotFound)
+
+	assert.True(t, http.ContentDisposition("inline", `a "b".txt`) == `inline; filename="a \"b\".txt"`)
+}
+
+func Test_Session(t *testing.T) {
+
+	var srv = &server.Server{}
+	var sessionTS = httptest.NewServer(srv)
+	defer sessionTS.Close()
+
+	var sessions = &server.Sessions{Store: session.NewMemoryStore()}
+	srv.Use(sessions.Middleware)
+
+	var srvRouter = &server.Router{}
+	srvRouter.Route("GET", "/anonymous").Handler(func(stream *http.Stream) error {
+		return stream.EndString("anonymous")
+	})
+	srvRouter.Route("GET", "/set").Handler(func(stream *http.Stream) error {
+		stream.Session().Set("name", "lemo")
+		stream.Session().AddFlash("saved")
+		return stream.EndString("ok")
+	})
+	srvRouter.Route("GET", "/get").Handler(func(stream *http.Stream) error {
+		var name, _ = stream.Session().Get("name").(string)
+		var flashes = stream.Session().Flashes()
+		return stream.EndString(name + " " + strconv.Itoa(len(flashes)))
+	})
+	srvRouter.Route("GET", "/login").Handler(func(stream *http.Stream) error {
+		stream.Session().Rotate()
+		stream.Session().Set("user", 1)
+		return stream.EndString("ok")
+	})
+	srvRouter.Route("GET", "/logout").Handler(func(stream *http.Stream) error {
+		stream.Session().Destroy()
+		return stream.EndString("ok")
+	})
+	srvRouter.Route("GET", "/late").Handler(func(stream *http.Stream) error {
+		_ = stream.EndString("ok")
+		stream.Session().Set("late", true)
+		return nil
+	})
+	srvRouter.Route("GET", "/hijack").Handler(func(stream *http.Stream) error {
+		stream.Session().Set("hijacked", true)
+		return hijackHandler(stream)
+	})
+	srvRouter.Route("GET", "/flush").Handler(func(stream *http.Stream) error {
+		flusher, ok := stream.Response.(http3.Flusher)
+		if !ok {
+			return errors.New("response can not be flushed")
+		}
+		_ = stream.EndString("a")
+		flusher.Flush()
+		return stream.EndString("b")
+	})
+	srv.SetRouter(srvRouter)
+
+	var cookie = func(res *request) *http3.Cookie {
+		var cookies = res.Response().Cookies()
+		for i := 0; i < len(cookies); i++ {
+			if cookies[i].Name == "kitty_session" {
+				return cookies[i]
+			}
+		}
+		return nil
+	}
+
+	// an empty session has no cookie
+	var res = Get(sessionTS.URL + "/anonymous").Query().Send()
+	assert.True(t, cookie(res) == nil)
+
+	res = Get(sessionTS.URL + "/set").Query().Send()
+	var c = cookie(res)
+	assert.True(t, c != nil && c.HttpOnly && c.SameSite == http3.SameSiteLaxMode)
+	var id = c.Value
+
+	// the flash is read once
+	res = Get(sessionTS.URL+"/get").SetHeader("Cookie", "kitty_session="+id).Query().Send()
+	assert.True(t, res.String() == "lemo 1", res.String())
+	assert.True(t, cookie(res) == nil)
+	res = Get(sessionTS.URL+"/get").SetHeader("Cookie", "kitty_session="+id).Query().Send()
+	assert.True(t, res.String() == "lemo 0", res.String())
+
+	// an unknown id is a new session
+	res = Get(sessionTS.URL+"/get").SetHeader("Cookie", "kitty_session=unknown").Query().Send()
+	assert.True(t, res.String() == " 0", res.String())
+
+	// a change after the response is saved
+	_ = Get(sessionTS.URL+"/late").SetHeader("Cookie", "kitty_session="+id).Query().Send()
+	var req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http3.Cookie{Name: "kitty_session", Value: id})
+	sess, err := sessions.Load(req)
+	assert.True(t, err == nil, err)
+	assert.True(t, sess.Get("late") == true)
+
+	// the upgrade and the flush of a stream go through the session
+	res = Get(sessionTS.URL+"/hijack").SetHeader("Cookie", "kitty_session="+id).Query().Send()
+	assert.True(t, res.String() == "hijacked", res.String())
+	sess, err = sessions.Load(req)
+	assert.True(t, err == nil && sess.Get("hijacked") == true, err)
+	res = Get(sessionTS.URL+"/flush").SetHeader("Cookie", "kitty_session="+id).Query().Send()
+	assert.True(t, res.String() == "ab", res.String())
+
+	// login rotates the id and keeps the values
+	res = Get(sessionTS.URL+"/login").SetHeader("Cookie", "kitty_session="+id).Query().Send()
+	c = cookie(res)
+	assert.True(t, c != nil && c.Value != id)
+	res = Get(sessionTS.URL+"/get").SetHeader("Cookie", "kitty_session="+id).Query().Send()
+	assert.True(t, res.String() == " 0", res.String())
+	id = c.Value
+	res = Get(sessionTS.URL+"/get").SetHeader("Cookie", "kitty_session="+id).Query().Send()
+	assert.True(t, res.String() == "lemo 0", res.String())
+
+	// the upgrade request of a websocket has the same session
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http3.Cookie{Name: "kitty_session", Value: id})
+	assert.True(t, sessions.ID(req) == id)
+	sess, err = sessions.Load(req)
+	assert.True(t, err == nil, err)
+	assert.True(t, !sess.IsNew() && sess.Get("user") == 1)
+
+	// logout removes the cookie
+	res = Get(sessionTS.URL+"/logout").SetHeader("Cookie", "kitty_session="+id).Query().Send()
+	c = cookie(res)
+	assert.True(t, c != nil && c.MaxAge == -1)
+	res = Get(sessionTS.URL+"/get").SetHeader("Cookie", "kitty_session="+id).Query().Send()
+	assert.True(t, res.String() == " 0", res.String())
+}
+
+func Test_Session_Expire(t *testing.T) {
+
+	var srv = &server.Server{}
+	var sessionTS = httptest.NewServer(srv)
+	defer sessionTS.Close()
+
+	store, err := session.NewFileStore(t.TempDir())
+	assert.True(t, err == nil, err)
+
+	var sessions = &server.Sessions{Store: store, IdleTimeout: 200 * time.Millisecond, AbsoluteTimeout: 500 * time.Millisecond}
+	srv.Use(sessions.Middleware)
+
+	var srvRouter = &server.Router{}
+	srvRouter.Route("GET", "/set").Handler(func(stream *http.Stream) error {
+		stream.Session().Set("n", 1)
+		return stream.EndString("ok")
+	})
+	srvRouter.Route("GET", "/get").Handler(func(stream *http.Stream) error {
+		return stream.EndString(strconv.FormatBool(stream.Session().Get("n") == 1))
+	})
+	srv.SetRouter(srvRouter)
+
+	var res = Get(sessionTS.URL + "/set").Query().Send()
+	var id = res.Response().Cookies()[0].Value
+
+	var get = func() string {
+		return Get(sessionTS.URL+"/get").SetHeader("Cookie", "kitty_session="+id).Query().Send().String()
+	}
+
+	// the requests keep it from the idle timeout
+	for i := 0; i < 3; i++ {
+		time.Sleep(100 * time.Millisecond)
+		assert.True(t, get() == "true")
+	}
+
+	// but not from the absolute timeout
+	time.Sleep(250 * time.Millisecond)
+	assert.True(t, get() == "false")
+
+	res = Get(sessionTS.URL + "/set").Query().Send()
+	id = res.Response().Cookies()[0].Value
+	time.Sleep(300 * time.Millisecond)
+	assert.True(t, get() == "false")
+}
+
+func Test_SecureCookie(t *testing.T) {
+
+	var oldKey = http.CookieKey{HashKey: bytes.Repeat([]byte("a"), 32), BlockKey: bytes.Repeat([]byte("b"), 32)}
+	var newKey = http.CookieKey{HashKey: bytes.Repeat([]byte("c"), 32)}
+
+	http.SetCookieKeys(oldKey)
+
+	type user struct {
+		Name string `json:"name"`
+	}
+
+	var httpServerRouter = &server.Router{}
+	httpServerRouter.Route("GET", "/set").Handler(func(stream *http.Stream) error {
+		stream.SetCookie("plain", "value", &http.CookieOptions{MaxAge: 60, AllowScript: true})
+		return stream.SetSecureCookie("user", user{Name: "lemo"}, nil)
+	})
+	httpServerRouter.Route("GET", "/get").Handler(func(stream *http.Stream) error {
+		var u user
+		if err := stream.SecureCookie("user", &u); err != nil {
+			return stream.EndString(err.Error())
+		}
+		return stream.EndString(u.Name + " " + stream.Cookie("plain"))
+	})
+	httpServerRouter.Route("GET", "/delete").Handler(func(stream *http.Stream) error {
+		stream.DeleteCookie("user", nil)
+		return nil
+	})
+	httpServer.SetRouter(httpServerRouter)
+
+	var res = Get(ts.URL + "/set").Query().Send()
+	var plain, secure = res.Cookie("plain"), res.Cookie("user")
+	assert.True(t, plain != nil && plain.Value == "value" && !plain.HttpOnly && plain.MaxAge == 60)
+	assert.True(t, secure != nil && secure.HttpOnly && secure.SameSite == http3.SameSiteLaxMode && secure.Path == "/" && !secure.Secure)
+
+	// it is encrypted
+	raw, err := base64.RawURLEncoding.DecodeString(secure.Value)
+	assert.True(t, err == nil, err)
+	assert.True(t, !bytes.Contains(raw, []byte("lemo")))
+
+	var get = func(cookie string) string {
+		return Get(ts.URL+"/get").SetHeader("Cookie", cookie).Query().Send().String()
+	}
+
+	assert.True(t, get("plain=value; user="+secure.Value) == "lemo value")
+	assert.True(t, get("plain=value") == http3.ErrNoCookie.Error())
+
+	// a forged value is rejected
+	var forged = []byte(secure.Value)
+	forged[10] ^= 1
+	assert.True(t, get("user="+string(forged)) == http.ErrCookieInvalid.Error())
+
+	// the old key verifies until it is removed
+	http.SetCookieKeys(newKey, oldKey)
+	assert.True(t, get("user="+secure.Value) == "lemo ")
+	res = Get(ts.URL + "/set").Query().Send()
+	raw, _ = base64.RawURLEncoding.DecodeString(res.Cookie("user").Value)
+	assert.True(t, bytes.Contains(raw, []byte("lemo")))
+
+	http.SetCookieKeys(newKey)
+	assert.True(t, get("user="+secure.Value) == http.ErrCookieInvalid.Error())
+	assert.True(t, get("user="+res.Cookie("user").Value) == "lemo ")
+
+	// too old
+	http.SecureCookieMaxAge = time.Nanosecond
+	time.Sleep(1100 * time.Millisecond)
+	assert.True(t, get("user="+res.Cookie("user").Value) == http.ErrCookieInvalid.Error())
+	http.SecureCookieMaxAge = 30 * 24 * time.Hour
+
+	// behind a https proxy
+	res = Get(ts.URL+"/set").SetHeader("X-Forwarded-Proto", "https").Query().Send()
+	assert.True(t, res.Cookie("user").Secure)
+
+	res = Get(ts.URL + "/delete").Query().Send()
+	assert.True(t, res.Cookie("user").MaxAge == -1)
+
+	// the value of another cookie is rejected
+	var header = http3.Header{"Cookie": {"other=" + secure.Value}}
+	var req = &http3.Request{Header: header}
+	var stream = http.NewStream(httptest.NewRecorder(), req)
+	var u user
+	http.SetCookieKeys(oldKey)
+	assert.True(t, stream.SecureCookie("other", &u) == http.ErrCookieInvalid)
+	assert.True(t, stream.SecureCookie("user", &u) == http3.ErrNoCookie)
+}
+
+func Test_CSRF(t *testing.T) {
+
+	var srv = &server.Server{}
+	var csrfTS = httptest.NewServer(srv)
+	defer csrfTS.Close()
+
+	var csrfErr error
+	srv.OnError = func(stream *http.Stream, err error) {
+		csrfErr = err
+	}
+
+	var csrf = &server.CSRF{ExemptNames: []string{"webhook"}, ExemptGroups: []string{"/api"}}
+	srv.Use(csrf.Middleware)
+
+	var srvRouter = &server.Router{}
+	srvRouter.Route("GET", "/form").Handler(func(stream *http.Stream) error {
+		return stream.EndString(string(stream.CSRFField()))
+	})
+	srvRouter.Route("POST", "/form").Handler(func(stream *http.Stream) error {
+		return stream.EndString("ok " + stream.ParseForm().First("name").String())
+	})
+	srvRouter.Route("POST", "/webhook").Name("webhook").Handler(func(stream *http.Stream) error {
+		return stream.EndString("ok")
+	})
+	srvRouter.Group("/api").Handler(func(handler *server.RouteHandler) {
+		handler.Post("/hook").Handler(func(stream *http.Stream) error {
+			return stream.EndString("ok")
+		})
+	})
+	srv.SetRouter(srvRouter)
+
+	var res = Get(csrfTS.URL + "/form").Query().Send()
+	var cookie = res.Cookie("kitty_csrf")
+	assert.True(t, cookie != nil && !cookie.HttpOnly)
+	var token = cookie.Value
+	assert.True(t, res.String() == `<input type="hidden" name="_csrf" value="`+token+`">`, res.String())
+
+	// the token is kept
+	res = Get(csrfTS.URL+"/form").SetHeader("Cookie", "kitty_csrf="+token).Query().Send()
+	assert.True(t, res.Cookie("kitty_csrf") == nil)
+
+	// by the form field or the header
+	res = Post(csrfTS.URL+"/form").SetHeader("Cookie", "kitty_csrf="+token).Form(kitty.M{"_csrf": token, "name": "lemo"}).Send()
+	assert.True(t, res.Code() == 200 && res.String() == "ok lemo", res.String())
+	res = Post(csrfTS.URL+"/form").SetHeader("Cookie", "kitty_csrf="+token).SetHeader("X-CSRF-Token", token).Form(kitty.M{"name": "lemo"}).Send()
+	assert.True(t, res.Code() == 200, res.Code())
+
+	// missing, wrong or without the cookie
+	csrfErr = nil
+	res = Post(csrfTS.URL+"/form").SetHeader("Cookie", "kitty_csrf="+token).Form(kitty.M{"name": "lemo"}).Send()
+	assert.True(t, res.Code() == http3.StatusForbidden && errors.Is(csrfErr, server.ErrCSRFToken))
+	res = Post(csrfTS.URL+"/form").SetHeader("Cookie", "kitty_csrf="+token).SetHeader("X-CSRF-Token", "wrong").Form(kitty.M{}).Send()
+	assert.True(t, res.Code() == http3.StatusForbidden)
+	res = Post(csrfTS.URL+"/form").SetHeader("X-CSRF-Token", token).Form(kitty.M{}).Send()
+	assert.True(t, res.Code() == http3.StatusForbidden)
+
+	// a cookie that is not signed, like one of a sibling subdomain
+	res = Post(csrfTS.URL+"/form").SetHeader("Cookie", "kitty_csrf=forged").SetHeader("X-CSRF-Token", "forged").Form(kitty.M{}).Send()
+	assert.True(t, res.Code() == http3.StatusForbidden && res.Cookie("kitty_csrf") != nil, res.Code())
+	var unsigned = token[:strings.LastIndexByte(token, '.')] + ".AAAA"
+	res = Post(csrfTS.URL+"/form").SetHeader("Cookie", "kitty_csrf="+unsigned).SetHeader("X-CSRF-Token", unsigned).Form(kitty.M{}).Send()
+	assert.True(t, res.Code() == http3.StatusForbidden, res.Code())
+
+	// exempt routes
+	res = Post(csrfTS.URL + "/webhook").Form(kitty.M{}).Send()
+	assert.True(t, res.Code() == 200, res.Code())
+	res = Post(csrfTS.URL + "/api/hook").Form(kitty.M{}).Send()
+	assert.True(t, res.Code() == 200, res.Code())
+}
+
+func Test_CSRF_Session(t *testing.T) {
+
+	var srv = &server.Server{}
+	var csrfTS = httptest.NewServer(srv)
+	defer csrfTS.Close()
+
+	var sessions = &server.Sessions{Store: session.NewMemoryStore()}
+	var csrf = &server.CSRF{}
+	srv.Use(sessions.Middleware, csrf.Middleware)
+
+	var srvRouter = &server.Router{}
+	srvRouter.Route("GET", "/token").Handler(func(stream *http.Stream) error {
+		return stream.EndString(stream.CSRFToken())
+	})
+	srvRouter.Route("POST", "/save").Handler(func(stream *http.Stream) error {
+		return stream.EndString("ok")
+	})
+	srv.SetRouter(srvRouter)
+
+	var res = Get(csrfTS.URL + "/token").Query().Send()
+	var token = res.String()
+	assert.True(t, token != "" && res.Cookie("kitty_csrf") == nil)
+	var id = res.Cookie("kitty_session").Value
+
+	res = Get(csrfTS.URL+"/token").SetHeader("Cookie", "kitty_session="+id).Query().Send()
+	assert.True(t, res.String() == token)
+
+	res = Post(csrfTS.URL+"/save").SetHeader("Cookie", "kitty_session="+id).SetHeader("X-CSRF-Token", token).Form(kitty.M{}).Send()
+	assert.True(t, res.Code() == 200, res.Code())
+
+	// the token of another session
+	res = Post(csrfTS.URL+"/save").SetHeader("X-CSRF-Token", token).Form(kitty.M{}).Send()
+	assert.True(t, res.Code() == http3.StatusForbidden, res.Code())
+}
@@ -25,6 +25,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/json-iterator/go"
 	"github.com/lemoyxk/kitty"
 )
@@ -36,6 +37,8 @@ func getRequest(method string, url string, info *info) (*http.Request, context.C
 		return doPostFormUrlencoded(method, url, info)
 	case kitty.ApplicationJson:
 		return doPostJson(method, url, info)
+	case kitty.ApplicationProtoBuf:
+		return doPostProtoBuf(method, url, info)
 	case kitty.MultipartFormData:
 		return doPostFormData(method, url, info)
 	default:
@@ -127,6 +130,26 @@ func doPostJson(method string, url string, info *info) (*http.Request, context.C
 	return request, cancel, err
 }
 
+func doPostProtoBuf(method string, url string, info *info) (*http.Request, context.CancelFunc, error) {
+	body, ok := info.body.(proto.Message)
+	if !ok {
+		return nil, nil, errors.New("application/x-protobuf body must be proto.Message")
+	}
+
+	protoBufBody, err := proto.Marshal(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	request, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(protoBufBody))
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return request, cancel, err
+}
+
 func doPostFormUrlencoded(method string, url string, info *info) (*http.Request, context.CancelFunc, error) {
 	if info.body == nil {
 		info.body = []map[string]interface{}{}
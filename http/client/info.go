@@ -16,6 +16,8 @@ import (
 	url2 "net/url"
 	"time"
 
+	"github.com/golang/protobuf/proto"
+
 	"github.com/lemoyxk/kitty"
 )
 
@@ -115,6 +117,16 @@ func (h *info) Json(body ...interface{}) *params {
 	return &params{info: h, req: request, cancel: cancel}
 }
 
+func (h *info) ProtoBuf(body proto.Message) *params {
+	h.SetHeader(kitty.ContentType, kitty.ApplicationProtoBuf)
+	h.body = body
+	request, cancel, err := getRequest(h.handler.method, h.handler.url, h)
+	if err != nil {
+		return &params{err: err}
+	}
+	return &params{info: h, req: request, cancel: cancel}
+}
+
 func (h *info) Query(body ...map[string]interface{}) *params {
 	h.body = body
 	request, cancel, err := getRequest(h.handler.method, h.handler.url, h)
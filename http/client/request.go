@@ -10,7 +10,11 @@
 
 package client
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/golang/protobuf/proto"
+)
 
 type request struct {
 	err      error
@@ -38,3 +42,25 @@ func (r *request) LastError() error {
 func (r *request) Response() *http.Response {
 	return r.response
 }
+
+// ProtoBuf decodes the body into msg.
+func (r *request) ProtoBuf(msg proto.Message) error {
+	if r.err != nil {
+		return r.err
+	}
+	return proto.Unmarshal(r.data, msg)
+}
+
+// Cookie returns the cookie the server sets, nil without it.
+func (r *request) Cookie(name string) *http.Cookie {
+	if r.response == nil {
+		return nil
+	}
+	var cookies = r.response.Cookies()
+	for i := 0; i < len(cookies); i++ {
+		if cookies[i].Name == name {
+			return cookies[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-21 09:40
+**/
+
+package http
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/json-iterator/go"
+
+	"github.com/lemoyxk/kitty"
+)
+
+// CookieKey signs the secure cookies with HashKey by HMAC-SHA256,
+// and encrypts them by AES-GCM when BlockKey is set.
+type CookieKey struct {
+	// HashKey has at least 32 bytes
+	HashKey []byte
+	// BlockKey has 16, 24 or 32 bytes for AES-128, AES-192 or AES-256
+	BlockKey []byte
+}
+
+// CookieOptions are the attributes of a cookie, nil is the defaults.
+type CookieOptions struct {
+	// Path is / if empty
+	Path   string
+	Domain string
+	// MaxAge is in seconds, 0 is a cookie of the browser session
+	MaxAge int
+	// SameSite is http.SameSiteLaxMode if 0
+	SameSite http.SameSite
+	// Secure is set when the request is https or SameSite is None
+	Secure bool
+	// AllowScript lets the scripts of the page read the cookie, it is HttpOnly else
+	AllowScript bool
+}
+
+// SecureCookieMaxAge rejects the secure cookies that are signed before, 0 never does.
+var SecureCookieMaxAge = 30 * 24 * time.Hour
+
+// ErrCookieInvalid is returned when a secure cookie is forged,
+// too old or signed by a key that is removed.
+var ErrCookieInvalid = errors.New("cookie is invalid")
+
+// maxCookieSize is the limit of the browsers.
+const maxCookieSize = 4096
+
+type cookieCodec struct {
+	hashKey []byte
+	aead    cipher.AEAD
+}
+
+var cookieKeys struct {
+	mux    sync.RWMutex
+	codecs []cookieCodec
+}
+
+// SetCookieKeys sets the keys of the secure cookies, the first one signs
+// and all of them verify, so an old key is kept until its cookies expire:
+//
+//	http.SetCookieKeys(http.CookieKey{HashKey: newKey}, http.CookieKey{HashKey: oldKey})
+func SetCookieKeys(keys ...CookieKey) {
+
+	if len(keys) == 0 {
+		panic("cookie keys can not be empty")
+	}
+
+	var codecs = make([]cookieCodec, len(keys))
+
+	for i := 0; i < len(keys); i++ {
+
+		if len(keys[i].HashKey) < 32 {
+			panic("hash key must have at least 32 bytes")
+		}
+
+		codecs[i].hashKey = keys[i].HashKey
+
+		if len(keys[i].BlockKey) == 0 {
+			continue
+		}
+
+		block, err := aes.NewCipher(keys[i].BlockKey)
+		if err != nil {
+			panic("block key is invalid: " + err.Error())
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			panic(err)
+		}
+
+		codecs[i].aead = aead
+	}
+
+	cookieKeys.mux.Lock()
+	cookieKeys.codecs = codecs
+	cookieKeys.mux.Unlock()
+}
+
+// Cookie returns the value of the cookie, empty without it.
+func (s *Stream) Cookie(name string) string {
+	cookie, err := s.Request.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// SetCookie adds a cookie to the response with the attributes of opts.
+func (s *Stream) SetCookie(name string, value string, opts *CookieOptions) {
+	http.SetCookie(s.Response, s.cookie(name, value, opts))
+}
+
+// DeleteCookie expires the cookie, opts has the path and the domain it is set with.
+func (s *Stream) DeleteCookie(name string, opts *CookieOptions) {
+	var cookie = s.cookie(name, "", opts)
+	cookie.MaxAge = -1
+	http.SetCookie(s.Response, cookie)
+}
+
+// SetSecureCookie encodes value by json, signs it with the first
+// key of SetCookieKeys and encrypts it when the key has a BlockKey.
+func (s *Stream) SetSecureCookie(name string, value interface{}, opts *CookieOptions) error {
+
+	cookieKeys.mux.RLock()
+	var codecs = cookieKeys.codecs
+	cookieKeys.mux.RUnlock()
+
+	if len(codecs) == 0 {
+		return errors.New("cookie keys are not set")
+	}
+
+	bts, err := jsoniter.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := codecs[0].encode(name, bts)
+	if err != nil {
+		return err
+	}
+
+	if len(name)+len(encoded) > maxCookieSize {
+		return errors.New("cookie " + name + " is too large")
+	}
+
+	s.SetCookie(name, encoded, opts)
+
+	return nil
+}
+
+// SecureCookie verifies the cookie with the keys of SetCookieKeys
+// and decodes it into dst. It returns http.ErrNoCookie without it
+// and ErrCookieInvalid when no key verifies it.
+func (s *Stream) SecureCookie(name string, dst interface{}) error {
+
+	cookie, err := s.Request.Cookie(name)
+	if err != nil {
+		return err
+	}
+
+	cookieKeys.mux.RLock()
+	var codecs = cookieKeys.codecs
+	cookieKeys.mux.RUnlock()
+
+	for i := 0; i < len(codecs); i++ {
+		bts, err := codecs[i].decode(name, cookie.Value)
+		if err != nil {
+			continue
+		}
+		return jsoniter.Unmarshal(bts, dst)
+	}
+
+	return ErrCookieInvalid
+}
+
+func (s *Stream) cookie(name string, value string, opts *CookieOptions) *http.Cookie {
+
+	if opts == nil {
+		opts = &CookieOptions{}
+	}
+
+	var cookie = &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     opts.Path,
+		Domain:   opts.Domain,
+		MaxAge:   opts.MaxAge,
+		Secure:   opts.Secure,
+		HttpOnly: !opts.AllowScript,
+		SameSite: opts.SameSite,
+	}
+
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+
+	if cookie.SameSite == 0 {
+		cookie.SameSite = http.SameSiteLaxMode
+	}
+
+	// the browsers drop SameSite=None without Secure
+	if s.Scheme() == "https" || s.Request.Header.Get(kitty.XForwardedProto) == "https" || cookie.SameSite == http.SameSiteNoneMode {
+		cookie.Secure = true
+	}
+
+	if opts.MaxAge > 0 {
+		cookie.Expires = time.Now().Add(time.Duration(opts.MaxAge) * time.Second)
+	}
+
+	return cookie
+}
+
+// encode returns base64(time | payload | mac), the payload is
+// nonce | sealed value when it is encrypted. The mac covers the name,
+// so a value can not be moved to another cookie.
+func (c cookieCodec) encode(name string, value []byte) (string, error) {
+
+	var payload = value
+
+	if c.aead != nil {
+		var nonce = make([]byte, c.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		payload = c.aead.Seal(nonce, nonce, value, []byte(name))
+	}
+
+	var msg = make([]byte, 8, 8+len(payload)+sha256.Size)
+	binary.BigEndian.PutUint64(msg, uint64(time.Now().Unix()))
+	msg = append(msg, payload...)
+	msg = append(msg, c.mac(name, msg)...)
+
+	return base64.RawURLEncoding.EncodeToString(msg), nil
+}
+
+func (c cookieCodec) decode(name string, value string) ([]byte, error) {
+
+	msg, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(msg) < 8+sha256.Size {
+		return nil, ErrCookieInvalid
+	}
+
+	var body, mac = msg[:len(msg)-sha256.Size], msg[len(msg)-sha256.Size:]
+	if !hmac.Equal(mac, c.mac(name, body)) {
+		return nil, ErrCookieInvalid
+	}
+
+	var signed = time.Unix(int64(binary.BigEndian.Uint64(body[:8])), 0)
+	if SecureCookieMaxAge > 0 && time.Since(signed) > SecureCookieMaxAge {
+		return nil, ErrCookieInvalid
+	}
+
+	var payload = body[8:]
+
+	if c.aead == nil {
+		return payload, nil
+	}
+
+	if len(payload) < c.aead.NonceSize() {
+		return nil, ErrCookieInvalid
+	}
+
+	return c.aead.Open(nil, payload[:c.aead.NonceSize()], payload[c.aead.NonceSize():], []byte(name))
+}
+
+func (c cookieCodec) mac(name string, msg []byte) []byte {
+	var h = hmac.New(sha256.New, c.hashKey)
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write(msg)
+	return h.Sum(nil)
+}
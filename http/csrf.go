@@ -0,0 +1,112 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-22 10:20
+**/
+
+package http
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+type csrfKey struct{}
+
+type csrfToken struct {
+	token string
+	field string
+}
+
+// WithCSRFToken returns r with the token of the CSRF middleware
+// and the name of its form field, CSRFToken returns it.
+func WithCSRFToken(r *http.Request, token string, field string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), csrfKey{}, csrfToken{token: token, field: field}))
+}
+
+// CSRFToken returns the token to send back in a form or a header,
+// it is empty without the CSRF middleware of the server.
+func (s *Stream) CSRFToken() string {
+	var t, _ = s.Request.Context().Value(csrfKey{}).(csrfToken)
+	return t.token
+}
+
+// CSRFField returns the hidden input of the token for a template:
+//
+//	<form method="post">{{ .CSRFField }}</form>
+func (s *Stream) CSRFField() template.HTML {
+	var t, ok = s.Request.Context().Value(csrfKey{}).(csrfToken)
+	if !ok {
+		return ""
+	}
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(t.field) +
+		`" value="` + template.HTMLEscapeString(t.token) + `">`)
+}
+
+// csrfProcessKey signs the tokens when SetCookieKeys is not called.
+var csrfProcessKey struct {
+	once sync.Once
+	key  []byte
+}
+
+func csrfCodecs() []cookieCodec {
+
+	cookieKeys.mux.RLock()
+	var codecs = cookieKeys.codecs
+	cookieKeys.mux.RUnlock()
+
+	if len(codecs) > 0 {
+		return codecs
+	}
+
+	csrfProcessKey.once.Do(func() {
+		csrfProcessKey.key = make([]byte, 32)
+		if _, err := rand.Read(csrfProcessKey.key); err != nil {
+			panic(err)
+		}
+	})
+
+	return []cookieCodec{{hashKey: csrfProcessKey.key}}
+}
+
+// SignCSRFToken signs token by the first key of SetCookieKeys, or by a key
+// of the process without them, the tokens are not valid after a restart then.
+func SignCSRFToken(token string) string {
+	var codecs = csrfCodecs()
+	return token + "." + base64.RawURLEncoding.EncodeToString(codecs[0].mac("csrf", []byte(token)))
+}
+
+// VerifyCSRFToken reports whether a token of SignCSRFToken
+// is signed by one of the keys of SetCookieKeys.
+func VerifyCSRFToken(signed string) bool {
+
+	var i = strings.LastIndexByte(signed, '.')
+	if i == -1 {
+		return false
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signed[i+1:])
+	if err != nil {
+		return false
+	}
+
+	var codecs = csrfCodecs()
+
+	for j := 0; j < len(codecs); j++ {
+		if hmac.Equal(mac, codecs[j].mac("csrf", []byte(signed[:i]))) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,16 +2,24 @@ package http
 
 import (
 	"bytes"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
+	"github.com/golang/protobuf/proto"
 	"github.com/json-iterator/go"
 
 	"github.com/lemoyxk/kitty"
+	"github.com/lemoyxk/kitty/session"
 )
 
 func NewStream(w http.ResponseWriter, r *http.Request) *Stream {
@@ -31,11 +39,15 @@ type Stream struct {
 	Context kitty.Context
 	Logger  kitty.Logger
 
-	maxMemory     int64
-	hasParseQuery bool
-	hasParseForm  bool
-	hasParseJson  bool
-	hasParseFiles bool
+	maxMemory        int64
+	hasParseQuery    bool
+	hasParseForm     bool
+	hasParseJson     bool
+	hasParseFiles    bool
+	hasParseProtoBuf bool
+	protoBuf         []byte
+	protoBufErr      error
+	sse              *SSE
 }
 
 func (s *Stream) Forward(fn func(stream *Stream) error) error {
@@ -54,6 +66,14 @@ func (s *Stream) JsonFormat(status string, code int, msg interface{}) error {
 	return s.EndJson(JsonFormat{Status: status, Code: code, Msg: msg})
 }
 
+// JsonInvalid answers 422 with the fields of a *BindError
+// or a *validate.Errors as msg.
+func (s *Stream) JsonInvalid(err error) error {
+	s.SetHeader("Content-Type", "application/json")
+	s.Response.WriteHeader(http.StatusUnprocessableEntity)
+	return s.JsonFormat("ERROR", http.StatusUnprocessableEntity, err)
+}
+
 func (s *Stream) End(data interface{}) error {
 	switch data.(type) {
 	case []byte:
@@ -75,6 +95,16 @@ func (s *Stream) EndJson(data interface{}) error {
 	return err
 }
 
+func (s *Stream) EndProtoBuf(msg proto.Message) error {
+	s.SetHeader("Content-Type", kitty.ApplicationProtoBuf)
+	bts, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = s.Response.Write(bts)
+	return err
+}
+
 func (s *Stream) EndString(data string) error {
 	_, err := s.Response.Write([]byte(data))
 	return err
@@ -87,10 +117,75 @@ func (s *Stream) EndBytes(data []byte) error {
 
 func (s *Stream) EndFile(fileName string, content interface{}) error {
 	s.SetHeader("Content-Type", "application/octet-stream")
-	s.SetHeader("content-Disposition", "attachment;filename="+fileName)
+	s.SetHeader("Content-Disposition", ContentDisposition("attachment", fileName))
 	return s.End(content)
 }
 
+// EndReader copies reader to the response, size is the Content-Length
+// or -1 when it is unknown, then the response is chunked.
+func (s *Stream) EndReader(reader io.Reader, size int64) error {
+	if size >= 0 {
+		s.SetHeader("Content-Length", strconv.FormatInt(size, 10))
+	}
+	if s.Response.Header().Get("Content-Type") == "" {
+		s.SetHeader("Content-Type", "application/octet-stream")
+	}
+	_, err := io.Copy(s.Response, reader)
+	return err
+}
+
+// EndFileFromDisk sends the file at path as an attachment without reading
+// it in memory. Range, If-Range and the conditional requests are served,
+// so a download can be resumed. A Content-Disposition set before is kept.
+func (s *Stream) EndFileFromDisk(path string) error {
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.Response.WriteHeader(http.StatusNotFound)
+		}
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		s.Response.WriteHeader(http.StatusNotFound)
+		return errors.New(path + " is a dir")
+	}
+
+	if s.Response.Header().Get("Content-Disposition") == "" {
+		s.SetHeader("Content-Disposition", ContentDisposition("attachment", info.Name()))
+	}
+
+	// a strong ETag, If-Range ignores the weak ones
+	s.SetHeader("ETag", `"`+strconv.FormatInt(info.Size(), 16)+"-"+strconv.FormatInt(info.ModTime().UnixNano(), 16)+`"`)
+
+	http.ServeContent(s.Response, s.Request, info.Name(), info.ModTime(), f)
+
+	return nil
+}
+
+// Write writes a chunk of the body, a Stream is an io.Writer
+// like for csv.NewWriter. Flush sends the chunks written.
+func (s *Stream) Write(p []byte) (int, error) {
+	return s.Response.Write(p)
+}
+
+// Flush sends the buffered body to the client.
+func (s *Stream) Flush() error {
+	flusher, ok := s.Response.(http.Flusher)
+	if !ok {
+		return errors.New("response can not flush")
+	}
+	flusher.Flush()
+	return nil
+}
+
 func (s *Stream) Host() string {
 	if host := s.Request.Header.Get(kitty.Host); host != "" {
 		return host
@@ -130,11 +225,35 @@ func (s *Stream) ParseJson() *Json {
 		return s.Json
 	}
 
+	s.Json.bytes = jsonBody
 	s.Json.any = jsoniter.Get(jsonBody)
 
 	return s.Json
 }
 
+// ParseProtoBuf decodes the body into msg, the body is read once
+// so it can be called again with another message.
+func (s *Stream) ParseProtoBuf(msg proto.Message) error {
+	bts, err := s.protoBufBody()
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(bts, msg)
+}
+
+func (s *Stream) protoBufBody() ([]byte, error) {
+
+	if s.hasParseProtoBuf {
+		return s.protoBuf, s.protoBufErr
+	}
+
+	s.hasParseProtoBuf = true
+
+	s.protoBuf, s.protoBufErr = ioutil.ReadAll(s.Request.Body)
+
+	return s.protoBuf, s.protoBufErr
+}
+
 func (s *Stream) ParseFiles() *Files {
 
 	if s.hasParseFiles {
@@ -256,6 +375,12 @@ func (s *Stream) AutoParse() {
 		s.ParseJson()
 		return
 	}
+
+	// the message is given to ParseProtoBuf
+	if isProtoBuf(header) {
+		_, _ = s.protoBufBody()
+		return
+	}
 }
 
 func (s *Stream) AutoGet(key string) Value {
@@ -316,6 +441,21 @@ func (s *Stream) String() string {
 	return ""
 }
 
+// PeerCertificate returns the verified certificate of the client,
+// nil without TLS or client certificates.
+func (s *Stream) PeerCertificate() *x509.Certificate {
+	if s.Request.TLS == nil || len(s.Request.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return s.Request.TLS.PeerCertificates[0]
+}
+
+// Session returns the session of the request, it is nil
+// without the Sessions middleware of the server.
+func (s *Stream) Session() *session.Session {
+	return session.FromContext(s.Request.Context())
+}
+
 func (s *Stream) Scheme() string {
 	var scheme = "http"
 	if s.Request.TLS != nil {
@@ -323,3 +463,52 @@ func (s *Stream) Scheme() string {
 	}
 	return scheme
 }
+
+// ContentDisposition formats the header of RFC 6266, a filename that is
+// not ascii is sent in filename* with an ascii fallback in filename.
+func ContentDisposition(disposition string, fileName string) string {
+
+	var ascii strings.Builder
+	var isASCII = true
+
+	for _, r := range fileName {
+		switch {
+		case r == '"' || r == '\\':
+			ascii.WriteByte('\\')
+			ascii.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+			ascii.WriteByte('_')
+		case r >= utf8.RuneSelf:
+			isASCII = false
+			ascii.WriteByte('_')
+		default:
+			ascii.WriteRune(r)
+		}
+	}
+
+	var value = disposition + `; filename="` + ascii.String() + `"`
+
+	if isASCII {
+		return value
+	}
+
+	var encoded strings.Builder
+	for i := 0; i < len(fileName); i++ {
+		var c = fileName[i]
+		if isAttrChar(c) {
+			encoded.WriteByte(c)
+			continue
+		}
+		encoded.WriteString(fmt.Sprintf("%%%02X", c))
+	}
+
+	return value + "; filename*=UTF-8''" + encoded.String()
+}
+
+// isAttrChar is the attr-char of RFC 5987.
+func isAttrChar(c byte) bool {
+	if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) != -1
+}
@@ -13,11 +13,13 @@ package http
 import "github.com/json-iterator/go"
 
 type Json struct {
-	any jsoniter.Any
+	any   jsoniter.Any
+	bytes []byte
 }
 
 func (j *Json) Reset(data interface{}) jsoniter.Any {
 	bts, _ := jsoniter.Marshal(data)
+	j.bytes = bts
 	j.any = jsoniter.Get(bts)
 	return j.any
 }
@@ -51,8 +53,9 @@ func (j *Json) Get(path ...interface{}) Value {
 	return Value{v: &p}
 }
 
+// Bytes returns the raw body.
 func (j *Json) Bytes() []byte {
-	return j.Bytes()
+	return j.bytes
 }
 
 func (j *Json) String() string {
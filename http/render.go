@@ -0,0 +1,340 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-18 10:05
+**/
+
+package http
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/json-iterator/go"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/lemoyxk/kitty"
+)
+
+// ErrUnsupported is returned by a Renderer or a Decoder
+// that can not handle the value, the next one is tried.
+var ErrUnsupported = errors.New("unsupported value")
+
+// Renderer encodes v as the body of a response.
+type Renderer func(v interface{}) ([]byte, error)
+
+// Decoder decodes the body of a request into v.
+type Decoder func(data []byte, v interface{}) error
+
+type renderer struct {
+	contentType string
+	render      Renderer
+}
+
+var formats = struct {
+	mux       sync.RWMutex
+	renderers []renderer
+	decoders  map[string]Decoder
+}{
+	renderers: []renderer{
+		{contentType: "application/json", render: renderJson},
+		{contentType: "application/xml", render: renderXML},
+		{contentType: "text/xml", render: renderXML},
+		{contentType: kitty.ApplicationProtoBuf, render: renderProtoBuf},
+		{contentType: "application/protobuf", render: renderProtoBuf},
+		{contentType: "application/msgpack", render: msgpack.Marshal},
+		{contentType: "application/x-msgpack", render: msgpack.Marshal},
+		{contentType: "text/plain", render: renderText},
+	},
+	decoders: map[string]Decoder{
+		"application/json":        decodeJson,
+		"application/xml":         xml.Unmarshal,
+		"text/xml":                xml.Unmarshal,
+		kitty.ApplicationProtoBuf: decodeProtoBuf,
+		"application/protobuf":    decodeProtoBuf,
+		"application/msgpack":     msgpack.Unmarshal,
+		"application/x-msgpack":   msgpack.Unmarshal,
+	},
+}
+
+// SetRenderer adds a renderer or replaces the one of contentType,
+// a new one is tried after the others when the client accepts */*.
+func SetRenderer(contentType string, render Renderer) {
+	if contentType == "" || render == nil {
+		panic("renderer is invalid")
+	}
+	formats.mux.Lock()
+	defer formats.mux.Unlock()
+
+	// Render reads the old slice without the lock, it is not changed
+	var renderers = make([]renderer, len(formats.renderers), len(formats.renderers)+1)
+	copy(renderers, formats.renderers)
+
+	for i := 0; i < len(renderers); i++ {
+		if renderers[i].contentType == contentType {
+			renderers[i].render = render
+			formats.renderers = renderers
+			return
+		}
+	}
+
+	formats.renderers = append(renderers, renderer{contentType: contentType, render: render})
+}
+
+// SetDecoder adds a decoder or replaces the one of contentType, Bind uses it.
+func SetDecoder(contentType string, decode Decoder) {
+	if contentType == "" || decode == nil {
+		panic("decoder is invalid")
+	}
+	formats.mux.Lock()
+	defer formats.mux.Unlock()
+	formats.decoders[contentType] = decode
+}
+
+// Render answers status with v in the first format of the Accept header
+// that can encode it, like json, xml, protobuf, msgpack or text.
+// It answers 406 when none can.
+func (s *Stream) Render(status int, v interface{}) error {
+
+	s.Response.Header().Add("Vary", "Accept")
+
+	var ranges = parseAccept(s.Request.Header.Get("Accept"))
+
+	formats.mux.RLock()
+	var renderers = formats.renderers
+	formats.mux.RUnlock()
+
+	for i := 0; i < len(ranges); i++ {
+		for j := 0; j < len(renderers); j++ {
+
+			if !ranges[i].match(renderers[j].contentType) {
+				continue
+			}
+
+			bts, err := renderers[j].render(v)
+			if err == ErrUnsupported {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			var contentType = renderers[j].contentType
+			if strings.HasPrefix(contentType, "text/") {
+				contentType += "; charset=utf-8"
+			}
+
+			s.SetHeader("Content-Type", contentType)
+			s.Response.WriteHeader(status)
+			_, err = s.Response.Write(bts)
+			return err
+		}
+	}
+
+	s.Response.WriteHeader(http.StatusNotAcceptable)
+
+	return nil
+}
+
+// decodeBody decodes the body by its Content-Type,
+// the forms are left to the tags.
+func (s *Stream) decodeBody(input interface{}) *FieldError {
+
+	mediaType, _, err := mime.ParseMediaType(s.Request.Header.Get("Content-Type"))
+	if err != nil {
+		return nil
+	}
+
+	formats.mux.RLock()
+	var decode, ok = formats.decoders[mediaType]
+	formats.mux.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	var source = mediaType[strings.IndexByte(mediaType, '/')+1:]
+	source = strings.TrimPrefix(source, "x-")
+
+	var bts []byte
+	if mediaType == kitty.ApplicationJson {
+		bts = s.ParseJson().Bytes()
+	} else if isProtoBuf(mediaType) {
+		bts, err = s.protoBufBody()
+		if err != nil {
+			return &FieldError{Source: source, Err: err}
+		}
+	} else {
+		bts, err = ioutil.ReadAll(s.Request.Body)
+		if err != nil {
+			return &FieldError{Source: source, Err: err}
+		}
+	}
+
+	if len(bts) == 0 {
+		return nil
+	}
+
+	if err := decode(bts, input); err != nil {
+		if mediaType != kitty.ApplicationJson {
+			return &FieldError{Source: source, Err: err}
+		}
+		return jsonFieldError(err)
+	}
+
+	return nil
+}
+
+type mediaRange struct {
+	typ     string
+	subtype string
+	q       float64
+}
+
+func (m mediaRange) match(contentType string) bool {
+	var i = strings.IndexByte(contentType, '/')
+	return (m.typ == "*" || m.typ == contentType[:i]) && (m.subtype == "*" || m.subtype == contentType[i+1:])
+}
+
+// parseAccept returns the ranges with a q above 0,
+// the highest q and the most specific first.
+func parseAccept(header string) []mediaRange {
+
+	if strings.TrimSpace(header) == "" {
+		return []mediaRange{{typ: "*", subtype: "*", q: 1}}
+	}
+
+	var ranges []mediaRange
+
+	var parts = strings.Split(header, ",")
+
+	for i := 0; i < len(parts); i++ {
+
+		var params = strings.Split(parts[i], ";")
+
+		var typ = strings.ToLower(strings.TrimSpace(params[0]))
+		var j = strings.IndexByte(typ, '/')
+		if j == -1 {
+			continue
+		}
+
+		var r = mediaRange{typ: typ[:j], subtype: typ[j+1:], q: 1}
+
+		for k := 1; k < len(params); k++ {
+			var param = strings.TrimSpace(params[k])
+			if strings.HasPrefix(param, "q=") {
+				r.q, _ = strconv.ParseFloat(param[2:], 64)
+			}
+		}
+
+		if r.q > 0 {
+			ranges = append(ranges, r)
+		}
+	}
+
+	var specificity = func(r mediaRange) int {
+		if r.typ == "*" {
+			return 0
+		}
+		if r.subtype == "*" {
+			return 1
+		}
+		return 2
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return specificity(ranges[i]) > specificity(ranges[j])
+	})
+
+	return ranges
+}
+
+// decodeJson decodes by jsoniter, its errors are only text, so a body
+// that fails is decoded again by encoding/json for the typed errors.
+func decodeJson(data []byte, v interface{}) error {
+
+	var err = jsoniter.Unmarshal(data, v)
+	if err == nil {
+		return nil
+	}
+
+	var t = reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return err
+	}
+
+	if e := json.Unmarshal(data, reflect.New(t.Elem()).Interface()); e != nil {
+		return e
+	}
+
+	return err
+}
+
+func renderJson(v interface{}) ([]byte, error) {
+	var bts, err = jsoniter.Marshal(v)
+	// jsoniter has no type for it, like "chan int is unsupported type"
+	if err != nil && strings.HasSuffix(err.Error(), "is unsupported type") {
+		return nil, ErrUnsupported
+	}
+	return bts, err
+}
+
+func renderXML(v interface{}) ([]byte, error) {
+	var bts, err = xml.Marshal(v)
+	var typeError *xml.UnsupportedTypeError
+	if errors.As(err, &typeError) {
+		return nil, ErrUnsupported
+	}
+	return bts, err
+}
+
+func isProtoBuf(contentType string) bool {
+	return strings.HasPrefix(contentType, kitty.ApplicationProtoBuf) || strings.HasPrefix(contentType, "application/protobuf")
+}
+
+func renderProtoBuf(v interface{}) ([]byte, error) {
+	var msg, ok = v.(proto.Message)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return proto.Marshal(msg)
+}
+
+func decodeProtoBuf(data []byte, v interface{}) error {
+	var msg, ok = v.(proto.Message)
+	if !ok {
+		return ErrUnsupported
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+func renderText(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case fmt.Stringer:
+		return []byte(v.String()), nil
+	case error:
+		return []byte(v.Error()), nil
+	}
+	return []byte(fmt.Sprintf("%v", v)), nil
+}
@@ -0,0 +1,404 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-14 11:02
+**/
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	http2 "github.com/lemoyxk/kitty/http"
+)
+
+// Encoder wraps the response body, like gzip.NewWriter.
+type Encoder func(w io.Writer) (io.WriteCloser, error)
+
+// Decoder wraps the request body, like gzip.NewReader.
+type Decoder func(r io.Reader) (io.ReadCloser, error)
+
+// Compress is a middleware that encodes the responses with the encoding
+// the client prefers and decodes the request bodies before they are parsed.
+//
+//	var compress = &server.Compress{}
+//	httpServer.Use(compress.Middleware)
+type Compress struct {
+	// Level of gzip and deflate, gzip.DefaultCompression if 0
+	Level int
+	// MinLength is the smallest body that is encoded, 1024 if 0,
+	// a flushed body is encoded whatever its length.
+	MinLength int
+	// SkipTypes are the prefixes of the content types
+	// that are compressed already, like image/png.
+	SkipTypes []string
+	// MaxBodySize limits a decoded request body, 32MB if 0.
+	MaxBodySize int64
+
+	once     sync.Once
+	encoders []encoder
+	decoders map[string]Decoder
+}
+
+type encoder struct {
+	name   string
+	encode Encoder
+}
+
+var defaultSkipTypes = []string{
+	"image/png", "image/jpeg", "image/gif", "image/webp", "image/avif",
+	"video/", "audio/", "font/woff",
+	"application/zip", "application/gzip", "application/x-gzip",
+	"application/x-brotli", "application/zstd", "application/pdf",
+}
+
+// SetEncoder adds an encoding of the responses, it is preferred to the
+// ones set before when the client accepts them with the same q.
+//
+//	compress.SetEncoder("br", func(w io.Writer) (io.WriteCloser, error) {
+//		return brotli.NewWriter(w), nil
+//	})
+func (c *Compress) SetEncoder(name string, encode Encoder) {
+	c.once.Do(c.ready)
+	name = strings.ToLower(name)
+	for i := 0; i < len(c.encoders); i++ {
+		if c.encoders[i].name == name {
+			c.encoders = append(c.encoders[:i], c.encoders[i+1:]...)
+			break
+		}
+	}
+	c.encoders = append([]encoder{{name: name, encode: encode}}, c.encoders...)
+}
+
+// SetDecoder adds an encoding of the request bodies.
+func (c *Compress) SetDecoder(name string, decode Decoder) {
+	c.once.Do(c.ready)
+	c.decoders[strings.ToLower(name)] = decode
+}
+
+func (c *Compress) ready() {
+
+	if c.Level == 0 {
+		c.Level = gzip.DefaultCompression
+	}
+
+	if c.MinLength == 0 {
+		c.MinLength = 1024
+	}
+
+	if c.SkipTypes == nil {
+		c.SkipTypes = defaultSkipTypes
+	}
+
+	if c.MaxBodySize == 0 {
+		c.MaxBodySize = 32 * 1024 * 1024
+	}
+
+	// http deflate is the zlib format
+	c.encoders = []encoder{
+		{name: "gzip", encode: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriterLevel(w, c.Level) }},
+		{name: "deflate", encode: func(w io.Writer) (io.WriteCloser, error) { return zlib.NewWriterLevel(w, c.Level) }},
+	}
+
+	c.decoders = map[string]Decoder{
+		"gzip":    func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+		"deflate": func(r io.Reader) (io.ReadCloser, error) { return zlib.NewReader(r) },
+	}
+}
+
+func (c *Compress) Middleware(next Middle) Middle {
+
+	c.once.Do(c.ready)
+
+	return func(stream *http2.Stream) {
+
+		if !c.decode(stream) {
+			return
+		}
+
+		if stream.Request.Method == http.MethodHead {
+			next(stream)
+			return
+		}
+
+		var w = &compressWriter{
+			ResponseWriter: stream.Response,
+			compress:       c,
+			encoder:        c.negotiate(stream.Request.Header.Get("Accept-Encoding")),
+			status:         http.StatusOK,
+		}
+
+		stream.Response = w
+
+		var done = false
+
+		defer func() {
+			// a panic is answered on the raw response
+			if !done {
+				stream.Response = w.ResponseWriter
+				w.abort()
+				return
+			}
+			w.close()
+		}()
+
+		next(stream)
+
+		done = true
+	}
+}
+
+// decode replaces the body of the request with the decoded one,
+// it answers and returns false when the encoding is unknown.
+func (c *Compress) decode(stream *http2.Stream) bool {
+
+	var name = strings.ToLower(strings.TrimSpace(stream.Request.Header.Get("Content-Encoding")))
+
+	if name == "" || name == "identity" {
+		return true
+	}
+
+	var decode, ok = c.decoders[name]
+	if !ok {
+		stream.Response.WriteHeader(http.StatusUnsupportedMediaType)
+		return false
+	}
+
+	body, err := decode(stream.Request.Body)
+	if err != nil {
+		stream.Response.WriteHeader(http.StatusBadRequest)
+		return false
+	}
+
+	stream.Request.Body = http.MaxBytesReader(stream.Response, body, c.MaxBodySize)
+	stream.Request.ContentLength = -1
+	stream.Request.Header.Del("Content-Encoding")
+	stream.Request.Header.Del("Content-Length")
+
+	return true
+}
+
+// negotiate returns the encoder with the highest q, nil for none.
+func (c *Compress) negotiate(header string) *encoder {
+
+	if header == "" {
+		return nil
+	}
+
+	var best *encoder
+	var bestQ = 0.0
+
+	for i := 0; i < len(c.encoders); i++ {
+		var q = encodingQ(header, c.encoders[i].name)
+		if q > bestQ {
+			best, bestQ = &c.encoders[i], q
+		}
+	}
+
+	return best
+}
+
+func (c *Compress) skip(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for i := 0; i < len(c.SkipTypes); i++ {
+		if strings.HasPrefix(contentType, c.SkipTypes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter buffers MinLength bytes before it chooses
+// to encode the body or to send it as it is.
+type compressWriter struct {
+	http.ResponseWriter
+	compress *Compress
+	encoder  *encoder
+
+	status      int
+	wroteHeader bool
+	started     bool
+	buffer      bytes.Buffer
+	writer      io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+	// no body follows
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		_ = w.start(false)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if !w.started {
+		w.buffer.Write(b)
+		if w.buffer.Len() < w.compress.MinLength {
+			return len(b), nil
+		}
+		if err := w.start(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if w.writer != nil {
+		return w.writer.Write(b)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressWriter) Flush() {
+
+	if !w.started {
+		_ = w.start(w.buffer.Len() > 0)
+	}
+
+	if f, ok := w.writer.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack sends what is buffered as it is and hands the connection
+// over, like for the upgrade of a websocket.
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+
+	var hijacker, ok = w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response can not be hijacked")
+	}
+
+	if !w.started {
+		if w.wroteHeader || w.buffer.Len() > 0 {
+			_ = w.start(false)
+		}
+		w.started = true
+	}
+
+	if w.writer != nil {
+		_ = w.writer.Close()
+		w.writer = nil
+	}
+
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the raw response.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// start writes the header and the buffer, encode is false
+// when the body is too small or empty.
+func (w *compressWriter) start(encode bool) error {
+
+	w.started = true
+
+	var header = w.ResponseWriter.Header()
+
+	if header.Get("Content-Type") == "" && w.buffer.Len() > 0 {
+		header.Set("Content-Type", http.DetectContentType(w.buffer.Bytes()))
+	}
+
+	// the encoding, a range or the type forbid it
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" ||
+		w.status == http.StatusPartialContent || w.compress.skip(header.Get("Content-Type")) {
+		encode = false
+	} else {
+		addVary(header, "Accept-Encoding")
+	}
+
+	if encode && w.encoder != nil {
+		writer, err := w.encoder.encode(w.ResponseWriter)
+		if err != nil {
+			return err
+		}
+		w.writer = writer
+		header.Set("Content-Encoding", w.encoder.name)
+		header.Del("Content-Length")
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+
+	if w.buffer.Len() == 0 {
+		return nil
+	}
+
+	var err error
+	if w.writer != nil {
+		_, err = w.writer.Write(w.buffer.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buffer.Bytes())
+	}
+
+	w.buffer.Reset()
+
+	return err
+}
+
+func (w *compressWriter) close() {
+
+	if !w.started {
+		if !w.wroteHeader && w.buffer.Len() == 0 {
+			// nothing was written, leave the status to net/http
+			w.started = true
+			return
+		}
+		_ = w.start(w.buffer.Len() >= w.compress.MinLength)
+	}
+
+	if w.writer != nil {
+		_ = w.writer.Close()
+	}
+}
+
+// abort drops the buffer that is not sent yet.
+func (w *compressWriter) abort() {
+	if !w.started {
+		w.started = true
+		w.buffer.Reset()
+	}
+	if w.writer != nil {
+		_ = w.writer.Close()
+	}
+}
+
+func addVary(header http.Header, value string) {
+	var vary = header.Values("Vary")
+	for i := 0; i < len(vary); i++ {
+		var parts = strings.Split(vary[i], ",")
+		for j := 0; j < len(parts); j++ {
+			if strings.EqualFold(strings.TrimSpace(parts[j]), value) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", value)
+}
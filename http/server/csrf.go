@@ -0,0 +1,189 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-22 11:05
+**/
+
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/lemoyxk/kitty"
+	http2 "github.com/lemoyxk/kitty/http"
+)
+
+// ErrCSRFToken is the error of OnError when the token
+// of an unsafe request is missing or wrong.
+var ErrCSRFToken = errors.New("csrf token is invalid")
+
+// csrfSessionKey is the key of the token in the session.
+const csrfSessionKey = "kitty_csrf"
+
+// CSRF is a middleware that checks a token on the unsafe methods,
+// the token is sent back in HeaderName or in the FieldName of a form.
+// The token is kept in the session when the Sessions middleware
+// runs before it, in a double-submit cookie else. The cookie is signed
+// by http.SetCookieKeys, a cookie that a sibling subdomain sets is not a token.
+//
+//	var csrf = &server.CSRF{ExemptNames: []string{"webhook"}}
+//	httpServer.Use(sessions.Middleware, csrf.Middleware)
+//
+// stream.CSRFToken and stream.CSRFField return the token for the pages.
+// A failed request is answered with 403 and ErrCSRFToken goes to OnError.
+type CSRF struct {
+	// HeaderName is X-CSRF-Token if empty
+	HeaderName string
+	// FieldName is _csrf if empty
+	FieldName string
+	// CookieName of the double-submit token is kitty_csrf if empty
+	CookieName string
+	// Cookie are the attributes of the double-submit cookie,
+	// the scripts can read it to send the header if nil.
+	Cookie *http2.CookieOptions
+	// ExemptNames are the names of the routes that are not checked, like webhooks
+	ExemptNames []string
+	// ExemptGroups are the paths of the groups whose routes are not checked
+	ExemptGroups []string
+
+	once sync.Once
+}
+
+type csrfKey struct{}
+
+// csrfResult is checked by dispatch when the route is known.
+type csrfResult struct {
+	csrf *CSRF
+	err  error
+}
+
+func (c *CSRF) ready() {
+
+	if c.HeaderName == "" {
+		c.HeaderName = "X-CSRF-Token"
+	}
+
+	if c.FieldName == "" {
+		c.FieldName = "_csrf"
+	}
+
+	if c.CookieName == "" {
+		c.CookieName = "kitty_csrf"
+	}
+
+	if c.Cookie == nil {
+		c.Cookie = &http2.CookieOptions{AllowScript: true}
+	}
+}
+
+func (c *CSRF) Middleware(next Middle) Middle {
+
+	c.once.Do(c.ready)
+
+	return func(stream *http2.Stream) {
+
+		var token, fresh = c.token(stream)
+
+		var err error
+		if !safeMethod(stream.Request.Method) && (fresh || !c.verify(stream, token)) {
+			err = ErrCSRFToken
+		}
+
+		var ctx = context.WithValue(stream.Request.Context(), csrfKey{}, &csrfResult{csrf: c, err: err})
+		stream.Request = http2.WithCSRFToken(stream.Request.WithContext(ctx), token, c.FieldName)
+
+		next(stream)
+	}
+}
+
+// token returns the token of the session or the cookie,
+// fresh is true when it is created by this request.
+func (c *CSRF) token(stream *http2.Stream) (string, bool) {
+
+	if sess := stream.Session(); sess != nil {
+		if token, ok := sess.Get(csrfSessionKey).(string); ok && token != "" {
+			return token, false
+		}
+		var token = newCSRFToken()
+		sess.Set(csrfSessionKey, token)
+		return token, true
+	}
+
+	if token := stream.Cookie(c.CookieName); token != "" && http2.VerifyCSRFToken(token) {
+		return token, false
+	}
+
+	var token = http2.SignCSRFToken(newCSRFToken())
+	stream.SetCookie(c.CookieName, token, c.Cookie)
+	return token, true
+}
+
+// verify compares the token with the header or the form field,
+// the token of the cookie is verified by token already.
+func (c *CSRF) verify(stream *http2.Stream, token string) bool {
+
+	var sent = stream.Request.Header.Get(c.HeaderName)
+
+	if sent == "" {
+		var contentType = stream.Request.Header.Get(kitty.ContentType)
+		if strings.HasPrefix(contentType, kitty.MultipartFormData) {
+			sent = stream.ParseMultipart().First(c.FieldName).String()
+		} else if strings.HasPrefix(contentType, kitty.ApplicationFormUrlencoded) {
+			sent = stream.ParseForm().First(c.FieldName).String()
+		}
+	}
+
+	return sent != "" && subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1
+}
+
+// exempt reports whether the route of n is not checked.
+func (c *CSRF) exempt(n *node) bool {
+	for i := 0; i < len(c.ExemptNames); i++ {
+		if n.Name != "" && n.Name == c.ExemptNames[i] {
+			return true
+		}
+	}
+	for i := 0; i < len(c.ExemptGroups); i++ {
+		if n.group == c.ExemptGroups[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCSRF returns the error of the CSRF middleware
+// when the route is not exempt, nil without the middleware.
+func checkCSRF(stream *http2.Stream, n *node) error {
+	var result, ok = stream.Request.Context().Value(csrfKey{}).(*csrfResult)
+	if !ok || result.err == nil || result.csrf.exempt(n) {
+		return nil
+	}
+	return result.err
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func newCSRFToken() string {
+	var b = make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,131 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-07 09:25
+**/
+
+package server
+
+import (
+	"net"
+	"strings"
+
+	"github.com/lemoyxk/kitty"
+)
+
+// host is a router selected by the Host of the request.
+//
+// Every label of the pattern is one of:
+//
+//	static  api.example.com
+//	param   :tenant.example.com or {tenant}.example.com
+//	*       *.tenant.example.com, only as the first label,
+//	        matches one or more labels saved as the param subdomain
+type host struct {
+	pattern string
+	labels  []string
+	router  *Router
+}
+
+func (h *host) match(labels []string) (kitty.Params, bool) {
+
+	var params kitty.Params
+
+	var i = len(h.labels) - 1
+	var j = len(labels) - 1
+
+	for ; i >= 0; i, j = i-1, j-1 {
+
+		var label = h.labels[i]
+
+		if label == "*" && i == 0 {
+			if j < 0 {
+				return params, false
+			}
+			params.Keys = append(params.Keys, "subdomain")
+			params.Values = append(params.Values, strings.Join(labels[:j+1], "."))
+			return params, true
+		}
+
+		if j < 0 {
+			return params, false
+		}
+
+		switch {
+		case strings.HasPrefix(label, ":"):
+			params.Keys = append(params.Keys, label[1:])
+			params.Values = append(params.Values, labels[j])
+		case strings.HasPrefix(label, "{") && strings.HasSuffix(label, "}"):
+			params.Keys = append(params.Keys, label[1:len(label)-1])
+			params.Values = append(params.Values, labels[j])
+		default:
+			if label != labels[j] {
+				return params, false
+			}
+		}
+	}
+
+	return params, j < 0
+}
+
+func (s *Server) SetHostRouter(pattern string, router *Router) *Server {
+
+	pattern = strings.ToLower(pattern)
+
+	if pattern == "" {
+		panic("host can not be empty")
+	}
+
+	for i := 0; i < len(s.hosts); i++ {
+		if s.hosts[i].pattern == pattern {
+			s.hosts[i].router = router
+			return s
+		}
+	}
+
+	var labels = strings.Split(pattern, ".")
+
+	for i := 1; i < len(labels); i++ {
+		if labels[i] == "*" {
+			panic(pattern + " is invalid, [*] must be the first label")
+		}
+	}
+
+	s.hosts = append(s.hosts, &host{pattern: pattern, labels: labels, router: router})
+
+	return s
+}
+
+// getRouter returns the router of the host, exact hosts first then
+// patterns in the order they were set, else the default router.
+func (s *Server) getRouter(hostPort string) (*Router, kitty.Params) {
+
+	if len(s.hosts) == 0 {
+		return s.router, kitty.Params{}
+	}
+
+	var name = strings.ToLower(hostPort)
+	if h, _, err := net.SplitHostPort(name); err == nil {
+		name = h
+	}
+
+	for i := 0; i < len(s.hosts); i++ {
+		if s.hosts[i].pattern == name {
+			return s.hosts[i].router, kitty.Params{}
+		}
+	}
+
+	var labels = strings.Split(name, ".")
+
+	for i := 0; i < len(s.hosts); i++ {
+		if params, ok := s.hosts[i].match(labels); ok {
+			return s.hosts[i].router, params
+		}
+	}
+
+	return s.router, kitty.Params{}
+}
@@ -0,0 +1,226 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-08 10:16
+**/
+
+package server
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/lemoyxk/caller"
+
+	"github.com/lemoyxk/kitty"
+	http2 "github.com/lemoyxk/kitty/http"
+	"github.com/lemoyxk/kitty/tire"
+)
+
+// mountMethod is the method of a mounted node, it answers every method
+// that is not registered on the same path.
+const mountMethod = "*"
+
+// mountKey is the catch-all param of a mount, it is not given to the handler.
+const mountKey = "path"
+
+type mount struct {
+	handler  http.Handler
+	router   *Router
+	wildcard bool
+}
+
+// Mount serves every path under prefix with a net/http handler,
+// the prefix is stripped from the request url.
+func (r *Router) Mount(prefix string, handler http.Handler) {
+	if handler == nil {
+		panic("mount handler can not be nil")
+	}
+	r.mount(prefix, &mount{handler: handler})
+}
+
+// MountRouter matches every path under prefix in another router,
+// params of the prefix are kept.
+func (r *Router) MountRouter(prefix string, router *Router) {
+	if router == nil || router == r {
+		panic("mount router is invalid")
+	}
+	r.mount(prefix, &mount{router: router})
+}
+
+func (r *Router) mount(prefix string, m *mount) {
+
+	file, line := caller.Deep(3)
+
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	var paths = []string{prefix + "/*" + mountKey}
+	if prefix != "" {
+		paths = append(paths, prefix)
+	}
+
+	if r.tire == nil {
+		r.tire = new(tire.Tire)
+	}
+
+	var info = file + ":" + strconv.Itoa(line)
+
+	for i := 0; i < len(paths); i++ {
+
+		var path = r.formatPath(paths[i])
+
+		var t *table
+		if n := r.tire.Get(path); n != nil {
+			t = n.Data.(*table)
+			if t.path != path {
+				panic(path + " (" + info + ") is conflict with " + t.nodes[0].Info)
+			}
+		} else {
+			t = &table{path: path}
+			if err := r.tire.Insert(path, t); err != nil {
+				if e, ok := err.(*tire.ConflictError); ok {
+					panic(path + " (" + info + ") is conflict with " + e.Conflict.Data.(*table).nodes[0].Info)
+				}
+				panic(err)
+			}
+		}
+
+		if h := t.get(mountMethod); h != nil {
+			panic(path + " (" + info + ") is conflict with " + h.Info)
+		}
+
+		t.nodes = append(t.nodes, &node{
+			Info:   info,
+			Route:  []byte(path),
+			Method: mountMethod,
+			mount:  &mount{handler: m.handler, router: m.router, wildcard: i == 0},
+		})
+	}
+}
+
+// HandlerFunc turns a route function into a http.HandlerFunc, an error
+// or a panic is answered with 500 when nothing is written yet.
+// The panic goes on as a *kitty.PanicError, the Server that serves
+// the mount reports it by OnError like the panics of its routes.
+func HandlerFunc(fn func(stream *http2.Stream) error) http.HandlerFunc {
+
+	file, line := caller.Deep(2)
+
+	var info = file + ":" + strconv.Itoa(line)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		var hw = &handlerWriter{ResponseWriter: w}
+
+		var stream = http2.NewStream(hw, r)
+
+		defer func() {
+
+			stream.Finish()
+
+			var err = recover()
+			if err == nil {
+				return
+			}
+
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			if !hw.started {
+				hw.WriteHeader(http.StatusInternalServerError)
+			}
+
+			panic(answeredPanic{kitty.NewPanicError(err, info)})
+		}()
+
+		if err := fn(stream); err != nil && !hw.started {
+			http.Error(hw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+	}
+}
+
+// answeredPanic is the panic of a HandlerFunc, its response is done.
+type answeredPanic struct {
+	*kitty.PanicError
+}
+
+// handlerWriter knows whether the response of a HandlerFunc is started.
+type handlerWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *handlerWriter) WriteHeader(status int) {
+	w.started = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *handlerWriter) Write(b []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *handlerWriter) Flush() {
+	w.started = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *handlerWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	var hijacker, ok = w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response can not be hijacked")
+	}
+	w.started = true
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the raw response.
+func (w *handlerWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// stripSegments removes the first n segments of a path.
+func stripSegments(path string, n int) string {
+	var i = 0
+	for k := 0; k < n; k++ {
+		var j = strings.IndexByte(path[i+1:], '/')
+		if j == -1 {
+			return "/"
+		}
+		i += j + 1
+	}
+	return path[i:]
+}
+
+// stripRequest returns a copy of the request with its url path
+// replaced by path, like http.StripPrefix does.
+func stripRequest(r *http.Request, path string) *http.Request {
+
+	var r2 = new(http.Request)
+	*r2 = *r
+	r2.URL = new(url.URL)
+	*r2.URL = *r.URL
+	r2.URL.Path = path
+	r2.URL.RawPath = ""
+
+	if r.URL.RawPath != "" {
+		var rawPath = stripSegments(r.URL.RawPath, strings.Count(r.URL.Path, "/")-strings.Count(path, "/"))
+		if p, err := url.PathUnescape(rawPath); err == nil && p == path {
+			r2.URL.RawPath = rawPath
+		}
+	}
+
+	return r2
+}
@@ -0,0 +1,356 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-06 11:02
+**/
+
+package server
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/json-iterator/go"
+	"gopkg.in/yaml.v3"
+)
+
+// Doc is the optional metadata of a route used by the OpenAPI document.
+// Request and Response are values of the Go types of the bodies,
+// they are only read by reflection.
+type Doc struct {
+	Summary     string
+	Description string
+	Tags        []string
+	Request     interface{}
+	Response    interface{}
+	Deprecated  bool
+}
+
+// OpenAPI describes the document and where the Server serves it.
+// The document is YAML when Path ends with .yaml or .yml, else JSON.
+type OpenAPI struct {
+	Path        string
+	Title       string
+	Version     string
+	Description string
+}
+
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components *Components                      `json:"components,omitempty"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+type Operation struct {
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	OperationID string               `json:"operationId,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+	Deprecated  bool                 `json:"deprecated,omitempty"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// JSON sorts the keys of paths and schemas like encoding/json,
+// so the document is the same every time.
+func (d *Document) JSON() ([]byte, error) {
+	return jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(d)
+}
+
+func (d *Document) YAML() ([]byte, error) {
+	// go through json so the yaml keys follow the json tags
+	bts, err := d.JSON()
+	if err != nil {
+		return nil, err
+	}
+	var res interface{}
+	if err := yaml.Unmarshal(bts, &res); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(res)
+}
+
+// Generate walks the router and builds the document.
+func (o *OpenAPI) Generate(router *Router) *Document {
+
+	var doc = &Document{
+		OpenAPI: "3.0.3",
+		Info:    Info{Title: o.Title, Version: o.Version, Description: o.Description},
+		Paths:   make(map[string]map[string]*Operation),
+	}
+
+	var schemas = &schemaBuilder{schemas: make(map[string]*Schema), names: make(map[reflect.Type]string)}
+
+	var nodes = router.GetAllRouters()
+
+	// the same order every time, so are the names of the components
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if string(nodes[i].Route) != string(nodes[j].Route) {
+			return string(nodes[i].Route) < string(nodes[j].Route)
+		}
+		return nodes[i].Method < nodes[j].Method
+	})
+
+	for i := 0; i < len(nodes); i++ {
+		var n = nodes[i]
+
+		if n.mount != nil {
+			continue
+		}
+
+		var path, params = openAPIPath(string(n.Route))
+
+		var op = &Operation{
+			OperationID: n.Name,
+			Parameters:  params,
+			Responses:   map[string]*Response{"200": {Description: "OK"}},
+		}
+
+		if n.Doc != nil {
+			op.Summary = n.Doc.Summary
+			op.Description = n.Doc.Description
+			op.Tags = n.Doc.Tags
+			op.Deprecated = n.Doc.Deprecated
+			if n.Doc.Request != nil {
+				op.RequestBody = &RequestBody{
+					Required: true,
+					Content:  map[string]*MediaType{"application/json": {Schema: schemas.schema(reflect.TypeOf(n.Doc.Request))}},
+				}
+			}
+			if n.Doc.Response != nil {
+				op.Responses["200"].Content = map[string]*MediaType{"application/json": {Schema: schemas.schema(reflect.TypeOf(n.Doc.Response))}}
+			}
+		}
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*Operation)
+		}
+
+		doc.Paths[path][strings.ToLower(n.Method)] = op
+	}
+
+	if len(schemas.schemas) > 0 {
+		doc.Components = &Components{Schemas: schemas.schemas}
+	}
+
+	return doc
+}
+
+// openAPIPath turns /users/{id:int}/*path into /users/{id}/{path}
+func openAPIPath(route string) (string, []*Parameter) {
+
+	var parts = strings.Split(route, "/")
+
+	var params []*Parameter
+
+	for i := 0; i < len(parts); i++ {
+		var name, constraint string
+
+		switch {
+		case strings.HasPrefix(parts[i], ":"), strings.HasPrefix(parts[i], "*"):
+			name = parts[i][1:]
+		case strings.HasPrefix(parts[i], "{") && strings.HasSuffix(parts[i], "}"):
+			name = parts[i][1 : len(parts[i])-1]
+			if index := strings.Index(name, ":"); index != -1 {
+				constraint = name[index+1:]
+				name = name[:index]
+			}
+		default:
+			continue
+		}
+
+		parts[i] = "{" + name + "}"
+
+		var schema = &Schema{Type: "string"}
+		switch constraint {
+		case "":
+		case "int", "uint":
+			schema = &Schema{Type: "integer"}
+		case "float":
+			schema = &Schema{Type: "number"}
+		case "bool":
+			schema = &Schema{Type: "boolean"}
+		case "uuid":
+			schema.Format = "uuid"
+		case "alpha":
+			schema.Pattern = "^[a-zA-Z]+$"
+		case "alnum":
+			schema.Pattern = "^[a-zA-Z0-9]+$"
+		case "hex":
+			schema.Pattern = "^[a-fA-F0-9]+$"
+		default:
+			schema.Pattern = "^(?:" + constraint + ")$"
+		}
+
+		params = append(params, &Parameter{Name: name, In: "path", Required: true, Schema: schema})
+	}
+
+	return strings.Join(parts, "/"), params
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+type schemaBuilder struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+// name returns the component of t, a type with the name of another one,
+// like a.User and b.User, gets a number after it.
+func (b *schemaBuilder) name(t reflect.Type) (string, bool) {
+
+	if name, ok := b.names[t]; ok {
+		return name, true
+	}
+
+	var name = t.Name()
+	for i := 2; ; i++ {
+		if _, ok := b.schemas[name]; !ok {
+			break
+		}
+		name = t.Name() + strconv.Itoa(i)
+	}
+
+	b.names[t] = name
+
+	return name, false
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) *Schema {
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Uint, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer"}
+	case reflect.Int32, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		var name, ok = b.name(t)
+		if !ok {
+			// placeholder first, so recursive types stop here
+			b.schemas[name] = &Schema{}
+			*b.schemas[name] = *b.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	default:
+		return &Schema{}
+	}
+}
+
+func (b *schemaBuilder) object(t reflect.Type) *Schema {
+
+	var res = &Schema{Type: "object", Properties: make(map[string]*Schema)}
+
+	for i := 0; i < t.NumField(); i++ {
+		var field = t.Field(i)
+
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		var name = strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		// embedded struct without a name is flattened like encoding/json does
+		if field.Anonymous && name == "" {
+			var ft = field.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				var embedded = b.object(ft)
+				for k, v := range embedded.Properties {
+					res.Properties[k] = v
+				}
+				continue
+			}
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		res.Properties[name] = b.schema(field.Type)
+	}
+
+	return res
+}
@@ -11,15 +11,15 @@
 package server
 
 import (
-	"os"
-	"path/filepath"
+	"errors"
 	"strconv"
 	"strings"
 
 	"github.com/lemoyxk/caller"
-	"github.com/lemoyxk/structure/tire"
 
+	"github.com/lemoyxk/kitty"
 	"github.com/lemoyxk/kitty/http"
+	"github.com/lemoyxk/kitty/tire"
 )
 
 type groupFunction func(handler *RouteHandler)
@@ -43,7 +43,7 @@ func (g *group) Before(before ...Before) *group {
 }
 
 func (g *group) Remove(path string) {
-	g.router.tire.Delete(g.path + path)
+	g.router.remove(g.path + path)
 }
 
 func (g *group) After(after ...After) *group {
@@ -60,7 +60,7 @@ type RouteHandler struct {
 }
 
 func (rh *RouteHandler) Remove(path string) {
-	rh.group.router.tire.Delete(rh.group.path + path)
+	rh.group.router.remove(rh.group.path + path)
 }
 
 func (rh *RouteHandler) Route(method string, path string) *route {
@@ -88,12 +88,18 @@ func (rh *RouteHandler) Patch(path string) *route {
 }
 
 func (rh *RouteHandler) Option(path string) *route {
-	return rh.Route("OPTION", path)
+	return rh.Route("OPTIONS", path)
+}
+
+func (rh *RouteHandler) Head(path string) *route {
+	return rh.Route("HEAD", path)
 }
 
 type route struct {
 	path        string
+	name        string
 	method      string
+	doc         *Doc
 	before      []Before
 	after       []After
 	passBefore  bool
@@ -103,6 +109,16 @@ type route struct {
 	group       *group
 }
 
+func (r *route) Name(name string) *route {
+	r.name = name
+	return r
+}
+
+func (r *route) Doc(doc Doc) *route {
+	r.doc = &doc
+	return r
+}
+
 func (r *route) Before(before ...Before) *route {
 	r.before = append(r.before, before...)
 	return r
@@ -153,6 +169,10 @@ func (r *route) Handler(fn function) {
 
 	var path = router.formatPath(g.path + r.path)
 
+	if _, ok := router.names[r.name]; ok && r.name != "" {
+		panic("route name " + r.name + " is exists")
+	}
+
 	if router.tire == nil {
 		router.tire = new(tire.Tire)
 	}
@@ -161,6 +181,12 @@ func (r *route) Handler(fn function) {
 
 	hba.Info = file + ":" + strconv.Itoa(line)
 
+	hba.Name = r.name
+
+	hba.group = g.path
+
+	hba.Doc = r.doc
+
 	hba.Function = fn
 
 	hba.Before = append(g.before, r.before...)
@@ -186,14 +212,42 @@ func (r *route) Handler(fn function) {
 
 	hba.Route = []byte(path)
 
-	router.tire.Insert(path, hba)
+	var t *table
+	if n := router.tire.Get(path); n != nil {
+		t = n.Data.(*table)
+		if t.path != path {
+			panic(path + " (" + hba.Info + ") is conflict with " + t.nodes[0].Info)
+		}
+	} else {
+		t = &table{path: path}
+		if err := router.tire.Insert(path, t); err != nil {
+			if e, ok := err.(*tire.ConflictError); ok {
+				panic(path + " (" + hba.Info + ") is conflict with " + e.Conflict.Data.(*table).nodes[0].Info)
+			}
+			panic(err)
+		}
+	}
+
+	if h := t.get(method); h != nil {
+		panic(method + " " + path + " (" + hba.Info + ") is conflict with " + h.Info)
+	}
+
+	t.nodes = append(t.nodes, hba)
+
+	// the name is kept only when the route is added
+	if r.name != "" {
+		if router.names == nil {
+			router.names = make(map[string]string)
+		}
+		router.names[r.name] = g.path + r.path
+	}
 }
 
 type Router struct {
 	IgnoreCase   bool
 	tire         *tire.Tire
-	prefixPath   string
-	staticPath   string
+	names        map[string]string
+	statics      []*Static
 	defaultIndex string
 	globalAfter  []After
 	globalBefore []Before
@@ -208,14 +262,30 @@ func (r *Router) SetGlobalAfter(after ...After) {
 }
 
 func (r *Router) Remove(path ...string) {
-	r.tire.Delete(strings.Join(path, ""))
+	r.remove(strings.Join(path, ""))
+}
+
+func (r *Router) remove(path string) {
+	if r.tire == nil {
+		return
+	}
+	path = r.formatPath(path)
+	r.tire.Delete(path)
+	for name, p := range r.names {
+		if r.formatPath(p) == path {
+			delete(r.names, name)
+		}
+	}
 }
 
 func (r *Router) GetAllRouters() []*node {
 	var res []*node
+	if r.tire == nil {
+		return res
+	}
 	var tires = r.tire.GetAllValue()
 	for i := 0; i < len(tires); i++ {
-		res = append(res, tires[i].Data.(*node))
+		res = append(res, tires[i].Data.(*table).nodes...)
 	}
 	return res
 }
@@ -224,33 +294,10 @@ func (r *Router) SetDefaultIndex(index string) {
 	r.defaultIndex = index
 }
 
+// SetStaticPath serves the files of staticPath under prefixPath,
+// use SetStatic for more options.
 func (r *Router) SetStaticPath(prefixPath string, staticPath string) {
-
-	if prefixPath == "" {
-		panic("prefixPath can not be empty")
-	}
-
-	if staticPath == "" {
-		panic("staticPath can not be empty")
-	}
-
-	absStaticPath, err := filepath.Abs(staticPath)
-	if err != nil {
-		panic(err)
-	}
-
-	info, err := os.Stat(absStaticPath)
-	if err != nil {
-		panic(err)
-	}
-
-	if !info.IsDir() {
-		panic("staticPath is not a dir")
-	}
-
-	r.prefixPath = prefixPath
-	r.staticPath = absStaticPath
-	r.defaultIndex = "index.html"
+	r.SetStatic(&Static{Prefix: prefixPath, Dir: staticPath})
 }
 
 func (r *Router) Group(path ...string) *group {
@@ -268,14 +315,22 @@ func (r *Router) Route(method string, path string) *route {
 	return (&RouteHandler{group: r.Group("")}).Route(method, path)
 }
 
-func (r *Router) getRoute(method string, path string) (*tire.Tire, []byte) {
+// URL builds the path of a named route, params are escaped
+// and every param of the route must be given.
+func (r *Router) URL(name string, params kitty.Params) (string, error) {
+	var path, ok = r.names[name]
+	if !ok {
+		return "", errors.New("route name " + name + " not found")
+	}
+	return tire.Build(path, params.Keys, params.Values)
+}
+
+func (r *Router) getRoute(path string) (*tire.Tire, []byte) {
 
 	if r.tire == nil {
 		return nil, nil
 	}
 
-	method = strings.ToUpper(method)
-
 	path = r.formatPath(path)
 
 	var pathB = []byte(path)
@@ -286,25 +341,71 @@ func (r *Router) getRoute(method string, path string) (*tire.Tire, []byte) {
 		return nil, nil
 	}
 
-	if t.Data.(*node).Method != method {
-		return nil, nil
-	}
-
 	return t, pathB
 }
 
 func (r *Router) formatPath(path string) string {
 	if r.IgnoreCase {
-		path = strings.ToLower(path)
+		path = tire.Lower(path)
 	}
 	return path
 }
 
+// table holds every method registered on the same path,
+// each with its own handler and Before/After chain.
+type table struct {
+	path  string
+	nodes []*node
+}
+
+func (t *table) get(method string) *node {
+	method = strings.ToUpper(method)
+	for i := 0; i < len(t.nodes); i++ {
+		if t.nodes[i].Method == method {
+			return t.nodes[i]
+		}
+	}
+	return nil
+}
+
+// allow returns the value of the Allow header for this path.
+// HEAD is served by GET and OPTIONS is answered automatically.
+func (t *table) allow() string {
+	var methods []string
+	var has = func(method string) bool {
+		for i := 0; i < len(methods); i++ {
+			if methods[i] == method {
+				return true
+			}
+		}
+		return false
+	}
+	for i := 0; i < len(t.nodes); i++ {
+		if t.nodes[i].Method == mountMethod {
+			continue
+		}
+		if !has(t.nodes[i].Method) {
+			methods = append(methods, t.nodes[i].Method)
+		}
+		if t.nodes[i].Method == "GET" && !has("HEAD") {
+			methods = append(methods, "HEAD")
+		}
+	}
+	if !has("OPTIONS") {
+		methods = append(methods, "OPTIONS")
+	}
+	return strings.Join(methods, ", ")
+}
+
 type node struct {
 	Info     string
+	Name     string
 	Route    []byte
 	Method   string
+	Doc      *Doc
 	Function function
 	Before   []Before
 	After    []After
+	mount    *mount
+	group    string
 }
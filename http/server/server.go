@@ -3,13 +3,14 @@ package server
 import (
 	"context"
 	"errors"
-	"io/ioutil"
-	"mime"
 	"net"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
+	"sync"
+	"time"
+
+	h2 "golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 
 	kitty "github.com/lemoyxk/kitty"
 	http2 "github.com/lemoyxk/kitty/http"
@@ -25,6 +26,9 @@ type Server struct {
 	CertFile string
 	// TLS KEY
 	KeyFile string
+	// TLSOptions replaces TLS, CertFile and KeyFile,
+	// it supports SNI, client certificates and reload.
+	TLSOptions *kitty.TLSOptions
 
 	OnOpen    func(stream *http2.Stream)
 	OnMessage func(stream *http2.Stream)
@@ -32,16 +36,65 @@ type Server struct {
 	OnError   func(stream *http2.Stream, err error)
 	OnSuccess func()
 
+	// ReadTimeout is 60s by default so a slow body can not hold a
+	// connection forever, a negative value disables it for long uploads.
+	ReadTimeout time.Duration
+	// ReadHeaderTimeout is 10s by default.
+	ReadHeaderTimeout time.Duration
+	// WriteTimeout is 0 by default, so streamed responses are not cut.
+	WriteTimeout time.Duration
+	// IdleTimeout is 120s by default.
+	IdleTimeout time.Duration
+	// MaxHeaderBytes is 1MB by default.
+	MaxHeaderBytes int
+	// ConnState is called when a client connection changes state.
+	ConnState func(conn net.Conn, state http.ConnState)
+	// Logger receives the errors of net/http, they go to stderr if it is nil.
+	Logger kitty.Logger
+	// H2C serves HTTP/2 without TLS, by prior knowledge or by upgrade.
+	H2C bool
+	// HTTP2 tunes HTTP/2 with TLS or H2C, like MaxConcurrentStreams
+	// and MaxReadFrameSize.
+	HTTP2 *h2.Server
+
+	OpenAPI *OpenAPI
+
+	// DisablePanicRecover lets a panic of a route or a middleware crash the process
+	DisablePanicRecover bool
+
 	middle    []func(next Middle) Middle
 	router    *Router
+	hosts     []*host
 	netListen net.Listener
 	server    *http.Server
+	conns     map[net.Conn]struct{}
+	mux       sync.Mutex
 }
 
 func (s *Server) Ready() {
 	if s.Addr == "" {
 		panic("Addr must set")
 	}
+
+	if s.TLS && s.TLSOptions == nil {
+		s.TLSOptions = &kitty.TLSOptions{CertFile: s.CertFile, KeyFile: s.KeyFile}
+	}
+
+	if s.ReadTimeout == 0 {
+		s.ReadTimeout = 60 * time.Second
+	}
+
+	if s.ReadHeaderTimeout == 0 {
+		s.ReadHeaderTimeout = 10 * time.Second
+	}
+
+	if s.IdleTimeout == 0 {
+		s.IdleTimeout = 120 * time.Second
+	}
+
+	if s.MaxHeaderBytes == 0 {
+		s.MaxHeaderBytes = http.DefaultMaxHeaderBytes
+	}
 }
 
 type Middle func(*http2.Stream)
@@ -60,6 +113,7 @@ func (s *Server) process(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) middleware(stream *http2.Stream) {
+	defer s.recover(stream, "")
 	var next Middle = s.handler
 	for i := len(s.middle) - 1; i >= 0; i-- {
 		next = s.middle[i](next)
@@ -74,7 +128,22 @@ func (s *Server) handler(stream *http2.Stream) {
 	}
 
 	// Get the router
-	n, formatPath := s.router.getRoute(stream.Request.Method, stream.Request.URL.Path)
+	router, hostParams := s.getRouter(stream.Host())
+
+	// openapi document, after the middleware that can protect it
+	if s.OpenAPI != nil && stream.Request.Method == http.MethodGet && stream.Request.URL.Path == s.OpenAPI.Path {
+		s.openAPIHandler(router, stream.Response)
+		return
+	}
+
+	s.dispatch(stream, router, stream.Request.URL.Path, hostParams)
+}
+
+// dispatch matches path in router, path is the request path
+// without the prefix of the routers it is mounted in.
+func (s *Server) dispatch(stream *http2.Stream, router *Router, path string, params kitty.Params) {
+
+	n, formatPath := router.getRoute(path)
 
 	if n == nil {
 		stream.Response.WriteHeader(http.StatusNotFound)
@@ -88,9 +157,84 @@ func (s *Server) handler(stream *http2.Stream) {
 		return
 	}
 
-	stream.Params = kitty.Params{Keys: n.Keys, Values: n.ParseParams(formatPath)}
+	var t = n.Data.(*table)
+
+	var nodeData = t.get(stream.Request.Method)
+
+	if nodeData == nil && stream.Request.Method == http.MethodHead {
+		// net/http drops the body of HEAD and keeps its Content-Length
+		nodeData = t.get(http.MethodGet)
+	}
+
+	if nodeData == nil {
+		nodeData = t.get(mountMethod)
+	}
+
+	if nodeData == nil && stream.Request.Method == http.MethodOptions {
+		stream.SetHeader("Allow", t.allow())
+		stream.Response.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if nodeData == nil {
+		stream.SetHeader("Allow", t.allow())
+		stream.Response.WriteHeader(http.StatusMethodNotAllowed)
+		var err = errors.New(stream.Request.Method + " " + stream.Request.URL.Path + " " + "405 method not allowed")
+		if s.OnError != nil {
+			s.OnError(stream, err)
+		}
+		if s.OnClose != nil {
+			s.OnClose(stream)
+		}
+		return
+	}
+
+	defer s.recover(stream, nodeData.Info)
+
+	defer stream.Finish()
+
+	// a mounted router checks its own route
+	if nodeData.mount == nil || nodeData.mount.router == nil {
+		if err := checkCSRF(stream, nodeData); err != nil {
+			stream.Response.WriteHeader(http.StatusForbidden)
+			if s.OnError != nil {
+				s.OnError(stream, err)
+			}
+			if s.OnClose != nil {
+				s.OnClose(stream)
+			}
+			return
+		}
+	}
+
+	var keys, values = n.Keys, n.ParseParams(formatPath)
+
+	if nodeData.mount != nil {
+		var rest = "/"
+		if nodeData.mount.wildcard {
+			rest = stripSegments(path, strings.Count(t.path, "/")-1)
+			keys, values = keys[:len(keys)-1], values[:len(values)-1]
+		}
+		params = kitty.Params{
+			Keys:   append(params.Keys, keys...),
+			Values: append(params.Values, values...),
+		}
+		if nodeData.mount.router != nil {
+			s.dispatch(stream, nodeData.mount.router, rest, params)
+			return
+		}
+		stream.Params = params
+		if s.OnMessage != nil {
+			s.OnMessage(stream)
+		}
+		nodeData.mount.handler.ServeHTTP(stream.Response, stripRequest(stream.Request, rest))
+		return
+	}
 
-	var nodeData = n.Data.(*node)
+	stream.Params = kitty.Params{
+		Keys:   append(params.Keys, keys...),
+		Values: append(params.Values, values...),
+	}
 
 	if s.OnMessage != nil {
 		s.OnMessage(stream)
@@ -133,50 +277,56 @@ func (s *Server) handler(stream *http2.Stream) {
 	}
 }
 
-func (s *Server) staticHandler(w http.ResponseWriter, r *http.Request) error {
-
-	if !strings.HasPrefix(r.URL.Path, s.router.prefixPath) {
-		return errors.New("not match")
+// recover answers 500 and reports a panic as a *kitty.PanicError through OnError.
+func (s *Server) recover(stream *http2.Stream, info string) {
+	if s.DisablePanicRecover {
+		return
 	}
-
-	var absFilePath = filepath.Join(s.router.staticPath, r.URL.Path[len(s.router.prefixPath):])
-
-	var info, err = os.Stat(absFilePath)
-	if err != nil {
-		return err
+	var err = recover()
+	if err == nil {
+		return
 	}
-
-	if info.IsDir() {
-		absFilePath = filepath.Join(absFilePath, s.router.defaultIndex)
-		if _, err := os.Stat(absFilePath); err != nil {
-			return errors.New("staticPath is not a file")
-		}
+	// the handler asks net/http to abort the response
+	if err == http.ErrAbortHandler {
+		panic(err)
 	}
+	// a HandlerFunc answers its own panic
+	var panicErr *kitty.PanicError
+	if answered, ok := err.(answeredPanic); ok {
+		panicErr = answered.PanicError
+	} else {
+		stream.Response.WriteHeader(http.StatusInternalServerError)
+		panicErr = kitty.NewPanicError(err, info)
+	}
+	if s.OnError != nil {
+		s.OnError(stream, panicErr)
+	}
+	if s.OnClose != nil {
+		s.OnClose(stream)
+	}
+}
 
-	// has found
-	var contentType = mime.TypeByExtension(filepath.Ext(absFilePath))
+func (s *Server) openAPIHandler(router *Router, w http.ResponseWriter) {
 
-	f, err := os.Open(absFilePath)
-	if err != nil {
-		w.WriteHeader(http.StatusForbidden)
-		return nil
-	}
+	var doc = s.OpenAPI.Generate(router)
 
-	bts, err := ioutil.ReadAll(f)
-	if err != nil {
-		w.WriteHeader(http.StatusForbidden)
-		return nil
+	var bts []byte
+	var err error
+
+	if strings.HasSuffix(s.OpenAPI.Path, ".yaml") || strings.HasSuffix(s.OpenAPI.Path, ".yml") {
+		w.Header().Set("Content-Type", "application/yaml")
+		bts, err = doc.YAML()
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		bts, err = doc.JSON()
 	}
 
-	w.Header().Set("Content-Type", contentType)
-	_, err = w.Write(bts)
 	if err != nil {
-		w.WriteHeader(http.StatusForbidden)
-		return nil
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
-	return nil
-
+	_, _ = w.Write(bts)
 }
 
 func (s *Server) SetRouter(router *Router) *Server {
@@ -193,12 +343,45 @@ func (s *Server) Start() {
 
 	s.Ready()
 
-	var server = http.Server{Addr: s.Addr, Handler: s}
+	var server = http.Server{
+		Addr:              s.Addr,
+		Handler:           s,
+		ReadTimeout:       s.ReadTimeout,
+		ReadHeaderTimeout: s.ReadHeaderTimeout,
+		WriteTimeout:      s.WriteTimeout,
+		IdleTimeout:       s.IdleTimeout,
+		MaxHeaderBytes:    s.MaxHeaderBytes,
+		ConnState:         s.connState,
+	}
+
+	if s.Logger != nil {
+		server.ErrorLog = kitty.NewErrorLog(s.Logger)
+	}
+
+	var h2s = s.HTTP2
+	if h2s == nil {
+		h2s = &h2.Server{}
+	}
+
+	if s.H2C {
+		server.Handler = h2c.NewHandler(s, h2s)
+	}
+
+	if s.TLSOptions != nil {
+		config, err := s.TLSOptions.ServerConfig()
+		if err != nil {
+			panic(err)
+		}
+		server.TLSConfig = config
+		if err := h2.ConfigureServer(&server, h2s); err != nil {
+			panic(err)
+		}
+	}
 
 	var err error
 	var netListen net.Listener
 
-	netListen, err = net.Listen("tcp", server.Addr)
+	netListen, err = kitty.Listen("tcp", server.Addr)
 
 	if err != nil {
 		panic(err)
@@ -212,8 +395,8 @@ func (s *Server) Start() {
 		s.OnSuccess()
 	}
 
-	if s.TLS {
-		err = server.ServeTLS(netListen, s.CertFile, s.KeyFile)
+	if s.TLSOptions != nil {
+		err = server.ServeTLS(netListen, "", "")
 	} else {
 		err = server.Serve(netListen)
 	}
@@ -223,22 +406,69 @@ func (s *Server) Start() {
 	}
 }
 
-func (s *Server) Shutdown() error {
-	return s.server.Shutdown(context.Background())
+// Shutdown stops accepting, closes idle connections and waits for the
+// active ones, keep-alive is disabled so they are closed after the
+// current response. Connections still active when ctx is done are killed.
+func (s *Server) Shutdown(ctx context.Context) (kitty.ShutdownReport, error) {
+
+	var report kitty.ShutdownReport
+
+	if s.TLSOptions != nil {
+		s.TLSOptions.Close()
+	}
+
+	s.mux.Lock()
+	var total = len(s.conns)
+	s.mux.Unlock()
+
+	var err = s.server.Shutdown(ctx)
+	if err == context.DeadlineExceeded || err == context.Canceled {
+		s.mux.Lock()
+		report.Killed = len(s.conns)
+		s.mux.Unlock()
+		_ = s.server.Close()
+	}
+
+	report.Drained = total - report.Killed
+
+	return report, err
+}
+
+// connState tracks the connections served by net/http,
+// hijacked connections belong to the handler.
+func (s *Server) connState(conn net.Conn, state http.ConnState) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	switch state {
+	case http.StateNew:
+		if s.conns == nil {
+			s.conns = make(map[net.Conn]struct{})
+		}
+		s.conns[conn] = struct{}{}
+	case http.StateHijacked, http.StateClosed:
+		delete(s.conns, conn)
+	}
+	if s.ConnState != nil {
+		s.ConnState(conn, state)
+	}
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
+	var router, _ = s.getRouter(r.Host)
+
 	// router not exists
-	if s.router == nil {
+	if router == nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
 	// static file
-	if s.router.staticPath != "" && r.Method == http.MethodGet {
-		err := s.staticHandler(w, r)
-		if err == nil {
+	if len(router.statics) > 0 && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		if router.serveStatic(w, r) {
+			return
+		}
+		if router.serveFallback(w, r) {
 			return
 		}
 	}
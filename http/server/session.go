@@ -0,0 +1,227 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-20 14:30
+**/
+
+package server
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	http2 "github.com/lemoyxk/kitty/http"
+	"github.com/lemoyxk/kitty/session"
+)
+
+// Sessions is a middleware that loads the session of the cookie before
+// the route, stream.Session returns it. It is saved before the response
+// is written, so the cookie of a new or rotated session can be sent.
+//
+//	var sessions = &server.Sessions{Store: session.NewMemoryStore()}
+//	httpServer.Use(sessions.Middleware)
+type Sessions struct {
+	Store session.Store
+	// IdleTimeout expires a session without requests, 30 minutes if 0.
+	IdleTimeout time.Duration
+	// AbsoluteTimeout expires a session after its first request, 24 hours if 0.
+	AbsoluteTimeout time.Duration
+
+	// CookieName is kitty_session if empty
+	CookieName string
+	// CookiePath is / if empty
+	CookiePath string
+	Domain     string
+	Secure     bool
+	// SameSite is http.SameSiteLaxMode if 0
+	SameSite http.SameSite
+
+	// OnError is called when the store fails,
+	// a session that can not be loaded is answered with 500.
+	OnError func(stream *http2.Stream, err error)
+
+	once    sync.Once
+	manager *session.Manager
+}
+
+func (s *Sessions) ready() {
+
+	if s.Store == nil {
+		panic("store can not be nil")
+	}
+
+	if s.CookieName == "" {
+		s.CookieName = "kitty_session"
+	}
+
+	if s.CookiePath == "" {
+		s.CookiePath = "/"
+	}
+
+	if s.SameSite == 0 {
+		s.SameSite = http.SameSiteLaxMode
+	}
+
+	s.manager = &session.Manager{Store: s.Store, IdleTimeout: s.IdleTimeout, AbsoluteTimeout: s.AbsoluteTimeout}
+}
+
+func (s *Sessions) Middleware(next Middle) Middle {
+
+	s.once.Do(s.ready)
+
+	return func(stream *http2.Stream) {
+
+		var id = s.ID(stream.Request)
+
+		sess, err := s.manager.Load(id)
+		if err != nil {
+			s.error(stream, err)
+			stream.Response.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		stream.Request = stream.Request.WithContext(session.NewContext(stream.Request.Context(), sess))
+
+		var w = &sessionWriter{ResponseWriter: stream.Response}
+		w.commit = func() { s.commit(stream, w, sess, id) }
+
+		stream.Response = w
+
+		next(stream)
+
+		if !w.committed {
+			w.before()
+			return
+		}
+
+		// the cookie is sent already
+		if sess.Changed() {
+			if err := s.manager.Save(sess); err != nil {
+				s.error(stream, err)
+			}
+		}
+	}
+}
+
+// ID returns the session id in the cookie of r, empty without one.
+func (s *Sessions) ID(r *http.Request) string {
+	s.once.Do(s.ready)
+	cookie, err := r.Cookie(s.CookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// Load returns the session of the cookie of r, out of the middleware,
+// like with the upgrade request of a websocket Conn.
+func (s *Sessions) Load(r *http.Request) (*session.Session, error) {
+	s.once.Do(s.ready)
+	return s.manager.Load(s.ID(r))
+}
+
+// Save writes a session that Load returns.
+func (s *Sessions) Save(sess *session.Session) error {
+	s.once.Do(s.ready)
+	return s.manager.Save(sess)
+}
+
+// commit saves the session and sets the cookie when the id is new,
+// or removes it when the session is destroyed.
+func (s *Sessions) commit(stream *http2.Stream, w http.ResponseWriter, sess *session.Session, id string) {
+
+	var destroyed = sess.Destroyed()
+	var rotated = sess.Rotated()
+	var isNew = sess.IsNew()
+
+	if err := s.manager.Save(sess); err != nil {
+		s.error(stream, err)
+		return
+	}
+
+	if destroyed {
+		if id != "" {
+			http.SetCookie(w, s.cookie("", -1))
+		}
+		return
+	}
+
+	if rotated || (isNew && !sess.IsNew()) {
+		http.SetCookie(w, s.cookie(sess.ID(), 0))
+	}
+}
+
+func (s *Sessions) cookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     s.CookieName,
+		Value:    value,
+		Path:     s.CookiePath,
+		Domain:   s.Domain,
+		MaxAge:   maxAge,
+		Secure:   s.Secure,
+		HttpOnly: true,
+		SameSite: s.SameSite,
+	}
+}
+
+func (s *Sessions) error(stream *http2.Stream, err error) {
+	if s.OnError != nil {
+		s.OnError(stream, err)
+	}
+}
+
+// sessionWriter commits the session before the header is written.
+type sessionWriter struct {
+	http.ResponseWriter
+	commit    func()
+	committed bool
+}
+
+func (w *sessionWriter) before() {
+	if w.committed {
+		return
+	}
+	w.committed = true
+	w.commit()
+}
+
+func (w *sessionWriter) WriteHeader(status int) {
+	w.before()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *sessionWriter) Write(b []byte) (int, error) {
+	w.before()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *sessionWriter) Flush() {
+	w.before()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack saves the session before the connection is handed over,
+// like for the upgrade of a websocket.
+func (w *sessionWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	var hijacker, ok = w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response can not be hijacked")
+	}
+	w.before()
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the raw response.
+func (w *sessionWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
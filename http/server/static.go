@@ -0,0 +1,454 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-13 15:48
+**/
+
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Static serves the files of Dir or FS under Prefix with the semantics
+// of http.ServeContent: ranges, conditional requests and ETags.
+type Static struct {
+	// Prefix is the url prefix, like /assets
+	Prefix string
+	// Dir is the dir on disk
+	Dir string
+	// FS is used instead of Dir, like an embed.FS
+	FS fs.FS
+	// Index is served for a dir, the default index of the router if empty
+	Index string
+	// Listing lists a dir that has no index
+	Listing bool
+	// StrongETag hashes the content of the file,
+	// else the ETag is weak and made of the size and the modtime.
+	// The files of FS and the files without a modtime, like the ones
+	// of an embed.FS, are always hashed.
+	StrongETag bool
+	// CacheControl rules, the first matching one is used
+	CacheControl []CacheControl
+	// Hidden patterns are matched with every segment of the path,
+	// matched files are not found. Names starting with . by default.
+	Hidden []string
+	// Precompressed serves the .br or .gz sibling of a file
+	// when the Accept-Encoding of the client allows it.
+	Precompressed bool
+	// Fallback is served for a GET of a html page that matches
+	// no file and no route, like index.html of a single page app.
+	// Paths with an extension are not found as usual.
+	Fallback string
+
+	fs    http.FileSystem
+	etags map[string]*etag
+	mux   sync.Mutex
+}
+
+// CacheControl sets the Cache-Control header to Value for the files
+// with the extension Ext, like .css, or under Prefix, like /js/.
+// Prefix is relative to the prefix of the Static.
+type CacheControl struct {
+	Ext    string
+	Prefix string
+	Value  string
+}
+
+type etag struct {
+	modTime time.Time
+	size    int64
+	value   string
+}
+
+// SetStatic adds a static mount, a mount with the same prefix is replaced.
+// The longest prefix is matched first.
+func (r *Router) SetStatic(static *Static) {
+
+	if static.Prefix == "" {
+		panic("prefixPath can not be empty")
+	}
+
+	if static.FS != nil {
+		static.fs = http.FS(static.FS)
+		r.addStatic(static)
+		return
+	}
+
+	if static.Dir == "" {
+		panic("staticPath can not be empty")
+	}
+
+	absStaticPath, err := filepath.Abs(static.Dir)
+	if err != nil {
+		panic(err)
+	}
+
+	info, err := os.Stat(absStaticPath)
+	if err != nil {
+		panic(err)
+	}
+
+	if !info.IsDir() {
+		panic("staticPath is not a dir")
+	}
+
+	static.Dir = absStaticPath
+	static.fs = http.Dir(absStaticPath)
+
+	r.addStatic(static)
+}
+
+// SetStaticFS serves the files of fsys under prefix,
+// use SetStatic with FS for more options.
+func (r *Router) SetStaticFS(prefix string, fsys fs.FS) {
+	r.SetStatic(&Static{Prefix: prefix, FS: fsys})
+}
+
+func (r *Router) addStatic(static *Static) {
+
+	if static.Hidden == nil {
+		static.Hidden = []string{".*"}
+	}
+
+	for i := 0; i < len(r.statics); i++ {
+		if r.statics[i].Prefix == static.Prefix {
+			r.statics[i] = static
+			return
+		}
+	}
+
+	r.statics = append(r.statics, static)
+
+	sort.SliceStable(r.statics, func(i, j int) bool {
+		return len(r.statics[i].Prefix) > len(r.statics[j].Prefix)
+	})
+}
+
+// serveStatic returns false when no file is found,
+// then the request goes to the routes.
+func (r *Router) serveStatic(w http.ResponseWriter, req *http.Request) bool {
+
+	for i := 0; i < len(r.statics); i++ {
+		var name, ok = r.statics[i].match(req.URL.Path)
+		if !ok {
+			continue
+		}
+		var index = r.statics[i].Index
+		if index == "" {
+			index = r.defaultIndex
+		}
+		if index == "" {
+			index = "index.html"
+		}
+		if r.statics[i].serve(w, req, name, index) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// serveFallback serves the fallback of a static when no route matches.
+func (r *Router) serveFallback(w http.ResponseWriter, req *http.Request) bool {
+
+	if n, _ := r.getRoute(req.URL.Path); n != nil {
+		return false
+	}
+
+	if path.Ext(req.URL.Path) != "" || !strings.Contains(req.Header.Get("Accept"), "text/html") {
+		return false
+	}
+
+	for i := 0; i < len(r.statics); i++ {
+		if r.statics[i].Fallback == "" {
+			continue
+		}
+		if _, ok := r.statics[i].match(req.URL.Path); !ok {
+			continue
+		}
+		var name = path.Clean("/" + r.statics[i].Fallback)
+		f, err := r.statics[i].fs.Open(name)
+		if err != nil {
+			continue
+		}
+		info, err := f.Stat()
+		if err != nil || info.IsDir() {
+			_ = f.Close()
+			continue
+		}
+		r.statics[i].serveFile(w, req, name, info, f)
+		_ = f.Close()
+		return true
+	}
+
+	return false
+}
+
+// match returns the clean name of the file under the prefix.
+func (s *Static) match(urlPath string) (string, bool) {
+
+	var prefix = strings.TrimSuffix(s.Prefix, "/")
+
+	if !strings.HasPrefix(urlPath, prefix) {
+		return "", false
+	}
+
+	var rest = urlPath[len(prefix):]
+
+	if rest != "" && rest[0] != '/' {
+		return "", false
+	}
+
+	var name = path.Clean("/" + rest)
+
+	// keep the slash of a dir
+	if strings.HasSuffix(rest, "/") && name != "/" {
+		name += "/"
+	}
+
+	return name, true
+}
+
+func (s *Static) hidden(name string) bool {
+	var parts = strings.Split(name, "/")
+	for i := 0; i < len(parts); i++ {
+		if parts[i] == "" {
+			continue
+		}
+		for j := 0; j < len(s.Hidden); j++ {
+			if ok, _ := path.Match(s.Hidden[j], parts[i]); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Static) serve(w http.ResponseWriter, r *http.Request, name string, index string) bool {
+
+	if s.hidden(name) {
+		return false
+	}
+
+	f, err := s.fs.Open(strings.TrimSuffix(name, "/"))
+	if err != nil {
+		if os.IsPermission(err) {
+			w.WriteHeader(http.StatusForbidden)
+			return true
+		}
+		return false
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	if info.IsDir() {
+
+		// relative links of the index need the slash
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			var target = path.Base(r.URL.Path) + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return true
+		}
+
+		var indexName = path.Join(name, index)
+
+		indexFile, err := s.fs.Open(indexName)
+		if err == nil {
+			defer func() { _ = indexFile.Close() }()
+			if indexInfo, err := indexFile.Stat(); err == nil && !indexInfo.IsDir() {
+				s.serveFile(w, r, indexName, indexInfo, indexFile)
+				return true
+			}
+		}
+
+		if s.Listing {
+			s.list(w, f)
+			return true
+		}
+
+		return false
+	}
+
+	s.serveFile(w, r, name, info, f)
+
+	return true
+}
+
+func (s *Static) serveFile(w http.ResponseWriter, r *http.Request, name string, info os.FileInfo, content io.ReadSeeker) {
+
+	// the type comes from the name of the file, not of the sibling
+	var typeName = info.Name()
+
+	for i := 0; i < len(s.CacheControl); i++ {
+		var rule = s.CacheControl[i]
+		if (rule.Ext != "" && strings.EqualFold(path.Ext(name), rule.Ext)) ||
+			(rule.Prefix != "" && strings.HasPrefix(name, rule.Prefix)) {
+			w.Header().Set("Cache-Control", rule.Value)
+			break
+		}
+	}
+
+	if s.Precompressed {
+		w.Header().Add("Vary", "Accept-Encoding")
+		for i := 0; i < len(encodings); i++ {
+			if !acceptsEncoding(r.Header.Get("Accept-Encoding"), encodings[i].name) {
+				continue
+			}
+			f, err := s.fs.Open(name + encodings[i].ext)
+			if err != nil {
+				continue
+			}
+			defer func() { _ = f.Close() }()
+			sibling, err := f.Stat()
+			if err != nil || sibling.IsDir() {
+				continue
+			}
+			w.Header().Set("Content-Encoding", encodings[i].name)
+			name, info, content = name+encodings[i].ext, sibling, f
+			break
+		}
+	}
+
+	if tag := s.etag(name, info, content); tag != "" {
+		w.Header().Set("ETag", tag)
+	}
+
+	http.ServeContent(w, r, typeName, info.ModTime(), content)
+}
+
+var encodings = []struct {
+	name string
+	ext  string
+}{
+	{name: "br", ext: ".br"},
+	{name: "gzip", ext: ".gz"},
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows encoding.
+func acceptsEncoding(header string, encoding string) bool {
+	return encodingQ(header, encoding) > 0
+}
+
+// encodingQ returns the q of encoding in an Accept-Encoding header,
+// the q of * when it is not listed and 0 when it is refused.
+func encodingQ(header string, encoding string) float64 {
+
+	var parts = strings.Split(header, ",")
+
+	var star = 0.0
+
+	for i := 0; i < len(parts); i++ {
+		var params = strings.Split(parts[i], ";")
+		var name = strings.ToLower(strings.TrimSpace(params[0]))
+
+		var q = 1.0
+		for j := 1; j < len(params); j++ {
+			var param = strings.TrimSpace(params[j])
+			if strings.HasPrefix(param, "q=") {
+				q, _ = strconv.ParseFloat(param[2:], 64)
+			}
+		}
+
+		if name == encoding {
+			return q
+		}
+
+		if name == "*" {
+			star = q
+		}
+	}
+
+	return star
+}
+
+func (s *Static) etag(name string, info os.FileInfo, content io.ReadSeeker) string {
+
+	// the size and a zero modtime do not tell two contents apart
+	if !s.StrongETag && s.FS == nil && !info.ModTime().IsZero() {
+		return `W/"` + strconv.FormatInt(info.Size(), 16) + "-" + strconv.FormatInt(info.ModTime().UnixNano(), 16) + `"`
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if e, ok := s.etags[name]; ok && e.size == info.Size() && e.modTime.Equal(info.ModTime()) {
+		return e.value
+	}
+
+	var hash = sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return ""
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return ""
+	}
+
+	var value = `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+
+	if s.etags == nil {
+		s.etags = make(map[string]*etag)
+	}
+
+	s.etags[name] = &etag{modTime: info.ModTime(), size: info.Size(), value: value}
+
+	return value
+}
+
+func (s *Static) list(w http.ResponseWriter, dir http.File) {
+
+	infos, err := dir.Readdir(-1)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	var b strings.Builder
+
+	b.WriteString("<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n<pre>\n")
+
+	for i := 0; i < len(infos); i++ {
+		var name = infos[i].Name()
+		if s.hidden(name) {
+			continue
+		}
+		if infos[i].IsDir() {
+			name += "/"
+		}
+		var u = url.URL{Path: name}
+		b.WriteString("<a href=\"" + html.EscapeString(u.String()) + "\">" + html.EscapeString(name) + "</a>\n")
+	}
+
+	b.WriteString("</pre>\n")
+
+	_, _ = io.WriteString(w, b.String())
+}
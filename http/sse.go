@@ -0,0 +1,221 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-19 14:12
+**/
+
+package http
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is a server-sent event, the empty fields are not sent.
+type Event struct {
+	ID    string
+	Event string
+	Data  string
+	// Retry is the reconnection time of the client
+	Retry time.Duration
+}
+
+// SSE writes server-sent events, it is closed by Close
+// or when the client is gone.
+type SSE struct {
+	// LastEventID is the id of the last event of the client
+	// when it reconnects, the events after it can be sent again.
+	LastEventID string
+
+	stream    *Stream
+	flusher   http.Flusher
+	mux       sync.Mutex
+	closed    bool
+	keepAlive time.Duration
+	reset     chan struct{}
+	stop      chan struct{}
+}
+
+// SSEKeepAlive is the default interval of the keep-alive comments.
+var SSEKeepAlive = 15 * time.Second
+
+// SSE starts an event stream, it is closed when the handler returns:
+//
+//	sse, err := stream.SSE()
+//	if err != nil {
+//		return err
+//	}
+//	for {
+//		select {
+//		case <-sse.Done():
+//			return nil
+//		case msg := <-messages:
+//			_ = sse.Send(http.Event{Event: "message", Data: msg})
+//		}
+//	}
+func (s *Stream) SSE() (*SSE, error) {
+
+	flusher, ok := s.Response.(http.Flusher)
+	if !ok {
+		return nil, errors.New("response can not flush")
+	}
+
+	var header = s.Response.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	// nginx buffers the response without it
+	header.Set("X-Accel-Buffering", "no")
+
+	s.Response.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var sse = &SSE{
+		LastEventID: s.Request.Header.Get("Last-Event-ID"),
+		stream:      s,
+		flusher:     flusher,
+		keepAlive:   SSEKeepAlive,
+		reset:       make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+	}
+
+	s.sse = sse
+
+	go sse.ping()
+
+	return sse, nil
+}
+
+// Finish closes the SSE of the stream, the server calls it when the route
+// returns, so nothing is written after the response is done.
+func (s *Stream) Finish() {
+	if s.sse != nil {
+		s.sse.Close()
+	}
+}
+
+// Done is closed when the client is gone.
+func (e *SSE) Done() <-chan struct{} {
+	return e.stream.Request.Context().Done()
+}
+
+// KeepAlive changes the interval of the keep-alive comments, 0 stops them.
+func (e *SSE) KeepAlive(interval time.Duration) {
+	e.mux.Lock()
+	e.keepAlive = interval
+	e.mux.Unlock()
+	select {
+	case e.reset <- struct{}{}:
+	default:
+	}
+}
+
+// Send writes event and flushes it.
+func (e *SSE) Send(event Event) error {
+
+	if strings.ContainsAny(event.ID, "\r\n") || strings.ContainsAny(event.Event, "\r\n") {
+		return errors.New("id and event can not have a newline")
+	}
+
+	var buf bytes.Buffer
+
+	if event.ID != "" {
+		buf.WriteString("id: " + event.ID + "\n")
+	}
+
+	if event.Event != "" {
+		buf.WriteString("event: " + event.Event + "\n")
+	}
+
+	if event.Retry > 0 {
+		buf.WriteString("retry: " + strconv.FormatInt(event.Retry.Milliseconds(), 10) + "\n")
+	}
+
+	var lines = strings.Split(strings.ReplaceAll(event.Data, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		buf.WriteString("data: " + lines[i] + "\n")
+	}
+
+	buf.WriteString("\n")
+
+	return e.write(buf.Bytes())
+}
+
+// Comment writes a comment, the client ignores it.
+func (e *SSE) Comment(comment string) error {
+	return e.write([]byte(": " + strings.ReplaceAll(comment, "\n", " ") + "\n\n"))
+}
+
+// Close stops the keep-alive and the events, a write in progress ends first.
+func (e *SSE) Close() {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+	if e.closed {
+		return
+	}
+	e.closed = true
+	close(e.stop)
+}
+
+func (e *SSE) write(bts []byte) error {
+
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	if e.closed {
+		return errors.New("sse is closed")
+	}
+
+	if err := e.stream.Request.Context().Err(); err != nil {
+		return err
+	}
+
+	if _, err := e.stream.Response.Write(bts); err != nil {
+		return err
+	}
+
+	e.flusher.Flush()
+
+	return nil
+}
+
+func (e *SSE) ping() {
+
+	for {
+
+		e.mux.Lock()
+		var interval = e.keepAlive
+		e.mux.Unlock()
+
+		var tick <-chan time.Time
+		var timer *time.Timer
+		if interval > 0 {
+			timer = time.NewTimer(interval)
+			tick = timer.C
+		}
+
+		select {
+		case <-e.stop:
+			return
+		case <-e.Done():
+			return
+		case <-e.reset:
+		case <-tick:
+			if e.Comment("ping") != nil {
+				return
+			}
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
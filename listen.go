@@ -0,0 +1,239 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-15 09:40
+**/
+
+package kitty
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The fds of systemd socket activation start at 3.
+const listenFdsStart = 3
+
+var listens struct {
+	mux       sync.Mutex
+	once      sync.Once
+	inherited []*os.File
+	active    []interface{}
+}
+
+type filer interface {
+	File() (*os.File, error)
+}
+
+// Listen returns the listener of addr inherited through LISTEN_FDS,
+// from systemd or from the parent of Restart, else a new one.
+func Listen(network string, addr string) (net.Listener, error) {
+
+	listens.mux.Lock()
+	defer listens.mux.Unlock()
+
+	listens.once.Do(inherit)
+
+	for i := 0; i < len(listens.inherited); i++ {
+		listener, err := net.FileListener(listens.inherited[i])
+		if err != nil {
+			continue
+		}
+		if !sameAddr(network, listener.Addr(), addr) {
+			_ = listener.Close()
+			continue
+		}
+		_ = listens.inherited[i].Close()
+		listens.inherited = append(listens.inherited[:i], listens.inherited[i+1:]...)
+		listens.active = append(listens.active, listener)
+		return listener, nil
+	}
+
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	listens.active = append(listens.active, listener)
+
+	return listener, nil
+}
+
+// ListenPacket is Listen for udp.
+func ListenPacket(network string, addr string) (net.PacketConn, error) {
+
+	listens.mux.Lock()
+	defer listens.mux.Unlock()
+
+	listens.once.Do(inherit)
+
+	for i := 0; i < len(listens.inherited); i++ {
+		conn, err := net.FilePacketConn(listens.inherited[i])
+		if err != nil {
+			continue
+		}
+		if !sameAddr(network, conn.LocalAddr(), addr) {
+			_ = conn.Close()
+			continue
+		}
+		_ = listens.inherited[i].Close()
+		listens.inherited = append(listens.inherited[:i], listens.inherited[i+1:]...)
+		listens.active = append(listens.active, conn)
+		return conn, nil
+	}
+
+	conn, err := net.ListenPacket(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	listens.active = append(listens.active, conn)
+
+	return conn, nil
+}
+
+// Restart starts a new process of the binary with the same args and
+// hands the listeners over through LISTEN_FDS. Both processes accept
+// until the old one calls Shutdown of its servers to drain the connections.
+func Restart() (*os.Process, error) {
+
+	listens.mux.Lock()
+	defer listens.mux.Unlock()
+
+	var files []*os.File
+
+	defer func() {
+		for i := 0; i < len(files); i++ {
+			_ = files[i].Close()
+		}
+	}()
+
+	var active []interface{}
+
+	for i := 0; i < len(listens.active); i++ {
+		f, ok := listens.active[i].(filer)
+		if !ok {
+			continue
+		}
+		// closed by Shutdown
+		file, err := f.File()
+		if err != nil {
+			continue
+		}
+		files = append(files, file)
+		active = append(active, listens.active[i])
+	}
+
+	listens.active = active
+
+	if len(files) == 0 {
+		return nil, errors.New("no listener to hand over")
+	}
+
+	path, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	var env []string
+	var environ = os.Environ()
+	for i := 0; i < len(environ); i++ {
+		if strings.HasPrefix(environ[i], "LISTEN_") {
+			continue
+		}
+		env = append(env, environ[i])
+	}
+
+	var cmd = exec.Command(path, os.Args[1:]...)
+	cmd.Env = append(env, "LISTEN_FDS="+strconv.Itoa(len(files)))
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return cmd.Process, nil
+}
+
+// inherit reads LISTEN_FDS once, LISTEN_PID is set by systemd
+// and is empty when the parent is Restart.
+func inherit() {
+
+	var pid = os.Getenv("LISTEN_PID")
+	if pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return
+	}
+
+	// the children do not inherit them again
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+
+	for i := 0; i < n; i++ {
+		listens.inherited = append(listens.inherited, os.NewFile(uintptr(listenFdsStart+i), "LISTEN_FD_"+strconv.Itoa(i)))
+	}
+}
+
+// sameAddr reports whether a listens on addr, like 127.0.0.1:8080 or :8080.
+func sameAddr(network string, a net.Addr, addr string) bool {
+
+	if !strings.HasPrefix(network, a.Network()) {
+		return false
+	}
+
+	if strings.HasPrefix(network, "unix") {
+		return a.String() == addr
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	aHost, aPort, err := net.SplitHostPort(a.String())
+	if err != nil {
+		return false
+	}
+
+	if p, err := net.LookupPort(network, port); err != nil || strconv.Itoa(p) != aPort {
+		return false
+	}
+
+	var aIP = net.ParseIP(aHost)
+
+	if host == "" {
+		return aIP != nil && aIP.IsUnspecified()
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = append(ips, ip)
+	} else {
+		ips, _ = net.LookupIP(host)
+	}
+
+	for i := 0; i < len(ips); i++ {
+		if ips[i].Equal(aIP) || (ips[i].IsUnspecified() && aIP.IsUnspecified()) {
+			return true
+		}
+	}
+
+	return false
+}
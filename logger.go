@@ -10,9 +10,29 @@
 
 package kitty
 
+import (
+	"log"
+	"strings"
+)
+
 type Logger interface {
 	Errorf(format string, args ...interface{})
 	Warningf(format string, args ...interface{})
 	Infof(format string, args ...interface{})
 	Debugf(format string, args ...interface{})
 }
+
+// NewErrorLog returns a *log.Logger that writes to logger.Errorf,
+// it is used as the ErrorLog of net/http servers.
+func NewErrorLog(logger Logger) *log.Logger {
+	return log.New(errorWriter{logger: logger}, "", 0)
+}
+
+type errorWriter struct {
+	logger Logger
+}
+
+func (w errorWriter) Write(p []byte) (int, error) {
+	w.logger.Errorf("%s", strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
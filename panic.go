@@ -0,0 +1,43 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-09 14:20
+**/
+
+package kitty
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is reported through OnError when a route, a hook
+// or a middleware panics. Info is the file:line of the route,
+// it is empty when the panic is out of a route.
+type PanicError struct {
+	Err   interface{}
+	Stack []byte
+	Info  string
+}
+
+func NewPanicError(err interface{}, info string) *PanicError {
+	return &PanicError{Err: err, Stack: debug.Stack(), Info: info}
+}
+
+func (e *PanicError) Error() string {
+	if e.Info == "" {
+		return fmt.Sprintf("panic: %v", e.Err)
+	}
+	return fmt.Sprintf("panic: %v at %s", e.Err, e.Info)
+}
+
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Err.(error); ok {
+		return err
+	}
+	return nil
+}
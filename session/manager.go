@@ -0,0 +1,137 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-20 10:48
+**/
+
+package session
+
+import (
+	"time"
+)
+
+// Store keeps the encoded sessions by id.
+type Store interface {
+	// Load returns nil without an error when id is unknown or expired.
+	Load(id string) ([]byte, error)
+	// Save keeps data for ttl.
+	Save(id string, data []byte, ttl time.Duration) error
+	Delete(id string) error
+}
+
+// Manager loads and saves the sessions of a store and expires them.
+type Manager struct {
+	Store Store
+	// IdleTimeout expires a session without requests, 30 minutes if 0.
+	IdleTimeout time.Duration
+	// AbsoluteTimeout expires a session after its first request, 24 hours if 0.
+	AbsoluteTimeout time.Duration
+}
+
+// Load returns the session of id, or a new one when id
+// is empty, unknown or expired.
+func (m *Manager) Load(id string) (*Session, error) {
+
+	if m.Store == nil {
+		panic("store can not be nil")
+	}
+
+	if id == "" {
+		return newSession(), nil
+	}
+
+	bts, err := m.Store.Load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if bts == nil {
+		return newSession(), nil
+	}
+
+	s, err := decode(id, bts)
+	if err != nil {
+		return newSession(), m.Store.Delete(id)
+	}
+
+	var now = time.Now()
+
+	if now.Sub(s.data.Accessed) > m.idle() || now.Sub(s.data.Created) > m.absolute() {
+		return newSession(), m.Store.Delete(id)
+	}
+
+	return s, nil
+}
+
+// Save writes the session when it has values or is saved already,
+// every save starts the idle timeout again.
+func (m *Manager) Save(s *Session) error {
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.oldID != "" {
+		if err := m.Store.Delete(s.oldID); err != nil {
+			return err
+		}
+		s.oldID = ""
+	}
+
+	if s.destroyed {
+		if s.isNew {
+			return nil
+		}
+		s.isNew = true
+		s.changed = false
+		return m.Store.Delete(s.id)
+	}
+
+	if s.isNew && s.empty() {
+		return nil
+	}
+
+	var now = time.Now()
+
+	var ttl = m.idle()
+	if left := s.data.Created.Add(m.absolute()).Sub(now); left < ttl {
+		ttl = left
+	}
+
+	if ttl <= 0 {
+		return m.Store.Delete(s.id)
+	}
+
+	s.data.Accessed = now
+
+	bts, err := s.encode()
+	if err != nil {
+		return err
+	}
+
+	if err := m.Store.Save(s.id, bts, ttl); err != nil {
+		return err
+	}
+
+	s.isNew = false
+	s.changed = false
+
+	return nil
+}
+
+func (m *Manager) idle() time.Duration {
+	if m.IdleTimeout == 0 {
+		return 30 * time.Minute
+	}
+	return m.IdleTimeout
+}
+
+func (m *Manager) absolute() time.Duration {
+	if m.AbsoluteTimeout == 0 {
+		return 24 * time.Hour
+	}
+	return m.AbsoluteTimeout
+}
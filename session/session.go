@@ -0,0 +1,211 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-20 10:12
+**/
+
+package session
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"sync"
+	"time"
+)
+
+// Session holds the values of a client between requests,
+// the values are encoded by gob, a custom type needs gob.Register.
+type Session struct {
+	mux       sync.Mutex
+	id        string
+	oldID     string
+	isNew     bool
+	changed   bool
+	destroyed bool
+	data      data
+}
+
+type data struct {
+	Values   map[string]interface{}
+	Flashes  []interface{}
+	Created  time.Time
+	Accessed time.Time
+}
+
+func newSession() *Session {
+	var now = time.Now()
+	return &Session{
+		id:    newID(),
+		isNew: true,
+		data:  data{Values: map[string]interface{}{}, Created: now, Accessed: now},
+	}
+}
+
+// ID is the id in the cookie.
+func (s *Session) ID() string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.id
+}
+
+// IsNew reports whether the session is not saved yet.
+func (s *Session) IsNew() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.isNew
+}
+
+// Created is the time of the first request, the absolute timeout starts there.
+func (s *Session) Created() time.Time {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.data.Created
+}
+
+func (s *Session) Get(key string) interface{} {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.data.Values[key]
+}
+
+func (s *Session) Set(key string, value interface{}) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.data.Values[key] = value
+	s.changed = true
+}
+
+func (s *Session) Delete(key string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, ok := s.data.Values[key]; !ok {
+		return
+	}
+	delete(s.data.Values, key)
+	s.changed = true
+}
+
+// Clear deletes all the values and the flashes.
+func (s *Session) Clear() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.data.Values = map[string]interface{}{}
+	s.data.Flashes = nil
+	s.changed = true
+}
+
+// AddFlash adds a message that is read once by Flashes,
+// like the result of a form after a redirect.
+func (s *Session) AddFlash(value interface{}) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.data.Flashes = append(s.data.Flashes, value)
+	s.changed = true
+}
+
+// Flashes returns the messages and removes them.
+func (s *Session) Flashes() []interface{} {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	var flashes = s.data.Flashes
+	if len(flashes) == 0 {
+		return nil
+	}
+	s.data.Flashes = nil
+	s.changed = true
+	return flashes
+}
+
+// Rotate gives the session a new id and keeps the values,
+// call it on login so a fixed id can not be used.
+func (s *Session) Rotate() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if !s.isNew && s.oldID == "" {
+		s.oldID = s.id
+	}
+	s.id = newID()
+	s.changed = true
+}
+
+// Destroy deletes the session from the store and the cookie, like on logout.
+func (s *Session) Destroy() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.destroyed = true
+	s.data.Values = map[string]interface{}{}
+	s.data.Flashes = nil
+}
+
+// Changed reports whether the session is changed since it is saved.
+func (s *Session) Changed() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.changed
+}
+
+// Destroyed reports whether Destroy is called.
+func (s *Session) Destroyed() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.destroyed
+}
+
+// Rotated reports whether the id is changed since the session is loaded,
+// the cookie must be sent again.
+func (s *Session) Rotated() bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.oldID != ""
+}
+
+func (s *Session) empty() bool {
+	return len(s.data.Values) == 0 && len(s.data.Flashes) == 0
+}
+
+func (s *Session) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(s.data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decode(id string, bts []byte) (*Session, error) {
+	var s = &Session{id: id}
+	if err := gob.NewDecoder(bytes.NewReader(bts)).Decode(&s.data); err != nil {
+		return nil, err
+	}
+	if s.data.Values == nil {
+		s.data.Values = map[string]interface{}{}
+	}
+	return s, nil
+}
+
+func newID() string {
+	var b = make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+type contextKey struct{}
+
+// NewContext returns ctx with s, Stream.Session reads it.
+func NewContext(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the session of ctx, nil without one.
+func FromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(contextKey{}).(*Session)
+	return s
+}
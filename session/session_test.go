@@ -0,0 +1,128 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-20 16:05
+**/
+
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testStore(t *testing.T, store Store) {
+
+	var m = &Manager{Store: store, IdleTimeout: time.Second}
+
+	s, err := m.Load("")
+	assert.True(t, err == nil, err)
+	assert.True(t, s.IsNew() && s.ID() != "")
+
+	// an empty session is not saved
+	assert.True(t, m.Save(s) == nil)
+	assert.True(t, s.IsNew())
+
+	s.Set("name", "lemo")
+	s.Set("age", 18)
+	s.AddFlash("hello")
+	assert.True(t, m.Save(s) == nil)
+	assert.True(t, !s.IsNew() && !s.Changed())
+
+	loaded, err := m.Load(s.ID())
+	assert.True(t, err == nil, err)
+	assert.True(t, !loaded.IsNew())
+	assert.True(t, loaded.Get("name") == "lemo" && loaded.Get("age") == 18)
+	assert.True(t, len(loaded.Flashes()) == 1 && loaded.Flashes() == nil)
+	assert.True(t, loaded.Changed())
+
+	// the old id is deleted on save
+	var old = loaded.ID()
+	loaded.Rotate()
+	assert.True(t, loaded.Rotated() && loaded.ID() != old)
+	assert.True(t, m.Save(loaded) == nil)
+	bts, err := store.Load(old)
+	assert.True(t, err == nil && bts == nil)
+
+	loaded, err = m.Load(loaded.ID())
+	assert.True(t, err == nil, err)
+	assert.True(t, loaded.Get("name") == "lemo")
+
+	loaded.Destroy()
+	assert.True(t, m.Save(loaded) == nil)
+	bts, err = store.Load(loaded.ID())
+	assert.True(t, err == nil && bts == nil)
+
+	// the store expires it with the ttl
+	assert.True(t, store.Save("expire", []byte("a"), 50*time.Millisecond) == nil)
+	bts, _ = store.Load("expire")
+	assert.True(t, string(bts) == "a")
+	time.Sleep(100 * time.Millisecond)
+	bts, _ = store.Load("expire")
+	assert.True(t, bts == nil)
+}
+
+func Test_MemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func Test_FileStore(t *testing.T) {
+
+	var dir = t.TempDir()
+
+	store, err := NewFileStore(dir)
+	assert.True(t, err == nil, err)
+
+	testStore(t, store)
+
+	// an id can not leave the directory
+	assert.True(t, store.Save("../escape", []byte("a"), time.Second) != nil)
+	bts, err := store.Load("../escape")
+	assert.True(t, err == nil && bts == nil)
+
+	// the expired files are swept
+	sweepInterval = 0
+	defer func() { sweepInterval = time.Minute }()
+
+	assert.True(t, store.Save("old", []byte("a"), time.Millisecond) == nil)
+	time.Sleep(10 * time.Millisecond)
+	assert.True(t, store.Save("new", []byte("b"), time.Second) == nil)
+
+	_, err = os.Stat(filepath.Join(dir, "old"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "new"))
+	assert.True(t, err == nil, err)
+}
+
+func Test_Manager_Expire(t *testing.T) {
+
+	var store = NewMemoryStore()
+	var m = &Manager{Store: store, IdleTimeout: time.Hour, AbsoluteTimeout: 50 * time.Millisecond}
+
+	s, _ := m.Load("")
+	s.Set("a", 1)
+	assert.True(t, m.Save(s) == nil)
+
+	time.Sleep(100 * time.Millisecond)
+
+	// the store keeps it, the manager does not
+	assert.True(t, store.Save(s.ID(), mustEncode(t, s), time.Hour) == nil)
+	loaded, err := m.Load(s.ID())
+	assert.True(t, err == nil, err)
+	assert.True(t, loaded.IsNew() && loaded.ID() != s.ID())
+	assert.True(t, store.Len() == 0)
+}
+
+func mustEncode(t *testing.T, s *Session) []byte {
+	bts, err := s.encode()
+	assert.True(t, err == nil, err)
+	return bts
+}
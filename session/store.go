@@ -0,0 +1,224 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-20 11:20
+**/
+
+package session
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often the expired sessions are removed on Save.
+var sweepInterval = time.Minute
+
+// MemoryStore keeps the sessions in the process, they are lost on restart.
+type MemoryStore struct {
+	mux       sync.Mutex
+	sessions  map[string]memoryEntry
+	lastSweep time.Time
+}
+
+type memoryEntry struct {
+	data   []byte
+	expire time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: map[string]memoryEntry{}, lastSweep: time.Now()}
+}
+
+func (m *MemoryStore) Load(id string) ([]byte, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	var entry, ok = m.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+
+	if time.Now().After(entry.expire) {
+		delete(m.sessions, id)
+		return nil, nil
+	}
+
+	return entry.data, nil
+}
+
+func (m *MemoryStore) Save(id string, data []byte, ttl time.Duration) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	var now = time.Now()
+
+	if now.Sub(m.lastSweep) > sweepInterval {
+		m.lastSweep = now
+		for key, entry := range m.sessions {
+			if now.After(entry.expire) {
+				delete(m.sessions, key)
+			}
+		}
+	}
+
+	var bts = make([]byte, len(data))
+	copy(bts, data)
+
+	m.sessions[id] = memoryEntry{data: bts, expire: now.Add(ttl)}
+
+	return nil
+}
+
+func (m *MemoryStore) Delete(id string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	delete(m.sessions, id)
+	return nil
+}
+
+// Len returns the count of the sessions, the expired ones not swept included.
+func (m *MemoryStore) Len() int {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return len(m.sessions)
+}
+
+// FileStore keeps a session per file in a directory,
+// the modification time of a file is the time it expires.
+type FileStore struct {
+	dir       string
+	mux       sync.Mutex
+	lastSweep time.Time
+}
+
+var errInvalidID = errors.New("invalid session id")
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir, lastSweep: time.Now()}, nil
+}
+
+func (f *FileStore) Load(id string) ([]byte, error) {
+
+	path, err := f.path(id)
+	if err != nil {
+		// a forged cookie is an unknown session
+		return nil, nil
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(info.ModTime()) {
+		_ = os.Remove(path)
+		return nil, nil
+	}
+
+	bts, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return bts, err
+}
+
+func (f *FileStore) Save(id string, data []byte, ttl time.Duration) error {
+
+	path, err := f.path(id)
+	if err != nil {
+		return err
+	}
+
+	f.sweep()
+
+	tmp, err := ioutil.TempFile(f.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	var expire = time.Now().Add(ttl)
+	if err := os.Chtimes(tmp.Name(), expire, expire); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (f *FileStore) Delete(id string) error {
+	path, err := f.path(id)
+	if err != nil {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// path returns the file of id, an id out of [A-Za-z0-9_-] is invalid.
+func (f *FileStore) path(id string) (string, error) {
+	if id == "" {
+		return "", errInvalidID
+	}
+	for i := 0; i < len(id); i++ {
+		var c = id[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return "", errInvalidID
+		}
+	}
+	return filepath.Join(f.dir, id), nil
+}
+
+// sweep removes the expired files at most once a sweepInterval.
+func (f *FileStore) sweep() {
+
+	f.mux.Lock()
+	var now = time.Now()
+	if now.Sub(f.lastSweep) <= sweepInterval {
+		f.mux.Unlock()
+		return
+	}
+	f.lastSweep = now
+	f.mux.Unlock()
+
+	files, err := ioutil.ReadDir(f.dir)
+	if err != nil {
+		return
+	}
+
+	for i := 0; i < len(files); i++ {
+		// a temp file is being saved
+		if files[i].IsDir() || strings.HasPrefix(files[i].Name(), ".tmp-") || now.Before(files[i].ModTime()) {
+			continue
+		}
+		_ = os.Remove(filepath.Join(f.dir, files[i].Name()))
+	}
+}
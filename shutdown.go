@@ -0,0 +1,19 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-10 16:05
+**/
+
+package kitty
+
+// ShutdownReport is returned by Shutdown of every server.
+type ShutdownReport struct {
+	// Drained connections were closed after their handlers finished
+	Drained int
+	// Killed connections were still busy when the context was done
+	Killed int
+}
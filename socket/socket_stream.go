@@ -12,8 +12,10 @@ package socket
 
 import (
 	"github.com/golang/protobuf/proto"
+	"github.com/json-iterator/go"
 
 	"github.com/lemoyxk/kitty"
+	"github.com/lemoyxk/kitty/validate"
 )
 
 // 0 version
@@ -58,6 +60,15 @@ type Stream struct {
 	Logger  kitty.Logger
 }
 
+// Bind decodes the json data into input and checks its validate tags,
+// a failed rule is in the *validate.Errors.
+func (s *Stream) Bind(input interface{}) error {
+	if err := jsoniter.Unmarshal(s.Data, input); err != nil {
+		return err
+	}
+	return validate.Struct(input)
+}
+
 type JsonPack struct {
 	Event string
 	Data  interface{}
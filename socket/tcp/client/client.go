@@ -1,6 +1,7 @@
 package client
 
 import (
+	"crypto/tls"
 	"errors"
 	"net"
 	"sync"
@@ -42,6 +43,13 @@ type Client struct {
 	PongHandler func(client *Client) func(appData string) error
 
 	Protocol tcp.Protocol
+	// TLSOptions dials the server with TLS
+	TLSOptions *kitty.TLSOptions
+
+	// DisablePanicRecover lets a panic of a route or a middleware crash the process
+	DisablePanicRecover bool
+	// CloseOnPanic closes the connection after a panic is recovered
+	CloseOnPanic bool
 
 	router                *Router
 	middle                []func(Middle) Middle
@@ -96,6 +104,9 @@ func (c *Client) Push(message []byte) error {
 }
 
 func (c *Client) Close() error {
+	if c.TLSOptions != nil {
+		c.TLSOptions.Close()
+	}
 	return c.Conn.Close()
 }
 
@@ -179,6 +190,26 @@ func (c *Client) Connect() {
 		panic(err)
 	}
 
+	if c.TLSOptions != nil {
+		config, err := c.TLSOptions.ClientConfig(c.Addr)
+		if err != nil {
+			_ = handler.Close()
+			c.OnError(err)
+			c.reconnecting()
+			return
+		}
+		var tlsConn = tls.Client(handler, config)
+		_ = tlsConn.SetDeadline(time.Now().Add(c.DailTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			_ = handler.Close()
+			c.OnError(err)
+			c.reconnecting()
+			return
+		}
+		_ = tlsConn.SetDeadline(time.Time{})
+		handler = tlsConn
+	}
+
 	c.Conn = handler
 
 	c.stopCh = make(chan struct{})
@@ -332,6 +363,12 @@ func (c *Client) decodeMessage(message []byte) error {
 		return c.PongHandler(c)("")
 	}
 
+	// Close, the server is shutting down and
+	// closes the connection after the current message
+	if messageType == socket.Close {
+		return nil
+	}
+
 	// on router
 	c.middleware(c, &socket.Stream{Pack: socket.Pack{Event: string(route), Data: body, ID: id}})
 
@@ -339,6 +376,7 @@ func (c *Client) decodeMessage(message []byte) error {
 }
 
 func (c *Client) middleware(conn *Client, stream *socket.Stream) {
+	defer c.recover(conn, "")
 	var next Middle = c.handler
 	for i := len(c.middle) - 1; i >= 0; i-- {
 		next = c.middle[i](next)
@@ -365,6 +403,8 @@ func (c *Client) handler(conn *Client, stream *socket.Stream) {
 
 	var nodeData = n.Data.(*node)
 
+	defer c.recover(conn, nodeData.Info)
+
 	stream.Params = kitty.Params{Keys: n.Keys, Values: n.ParseParams(formatPath)}
 
 	for i := 0; i < len(nodeData.Before); i++ {
@@ -395,6 +435,23 @@ func (c *Client) handler(conn *Client, stream *socket.Stream) {
 
 }
 
+// recover reports a panic as a *kitty.PanicError through OnError.
+func (c *Client) recover(conn *Client, info string) {
+	if c.DisablePanicRecover {
+		return
+	}
+	var err = recover()
+	if err == nil {
+		return
+	}
+	if c.OnError != nil {
+		c.OnError(kitty.NewPanicError(err, info))
+	}
+	if c.CloseOnPanic {
+		_ = conn.Close()
+	}
+}
+
 func (c *Client) SetRouter(router *Router) *Client {
 	c.router = router
 	return c
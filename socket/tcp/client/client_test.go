@@ -11,11 +11,23 @@
 package client
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/lemoyxk/kitty"
 	"github.com/lemoyxk/kitty/socket"
 	"github.com/lemoyxk/kitty/socket/tcp/server"
 	"github.com/stretchr/testify/assert"
@@ -71,6 +83,29 @@ func initServer(fn func()) {
 		})
 	})
 
+	tcpServerRouter.Route("/user/:id").Name("user").Handler(func(conn *server.Conn, stream *socket.Stream) error {
+		return conn.Emit(socket.Pack{
+			Event: stream.Event,
+			Data:  []byte(stream.Params.ByName("id")),
+			ID:    stream.ID,
+		})
+	})
+
+	tcpServerRouter.Route("/panic").Handler(func(conn *server.Conn, stream *socket.Stream) error {
+		panic("route panic")
+	})
+
+	tcpServerRouter.Route("/bind").Handler(func(conn *server.Conn, stream *socket.Stream) error {
+		var user struct {
+			Name string `json:"name" validate:"required,min=2"`
+		}
+		var data interface{} = "ok"
+		if err := stream.Bind(&user); err != nil {
+			data = err
+		}
+		return conn.JsonEmit(socket.JsonPack{Event: stream.Event, Data: data, ID: stream.ID})
+	})
+
 	tcpServerRouter.Route("/async").Handler(func(conn *server.Conn, stream *socket.Stream) error {
 		return conn.JsonEmit(socket.JsonPack{
 			Event: "/async",
@@ -127,7 +162,7 @@ func TestMain(t *testing.M) {
 		<-stop
 
 		_ = client.Close()
-		_ = tcpServer.Shutdown()
+		_, _ = tcpServer.Shutdown(context.Background())
 	}()
 
 	for {
@@ -152,6 +187,84 @@ func Test_Client_Async(t *testing.T) {
 	assert.True(t, string(stream.Data) == `"async test"`, "stream is nil")
 }
 
+func Test_Client_URL(t *testing.T) {
+	event, err := tcpServerRouter.URL("user", kitty.Params{Keys: []string{"id"}, Values: []string{"1"}})
+
+	assert.True(t, err == nil, err)
+
+	stream, err := client.Async().Emit(socket.Pack{Event: event})
+
+	assert.True(t, err == nil, err)
+
+	assert.True(t, string(stream.Data) == "1", "param not match")
+
+	// the event is not escaped
+	event, err = tcpServerRouter.URL("user", kitty.Params{Keys: []string{"id"}, Values: []string{"a b"}})
+	assert.True(t, err == nil && event == "/user/a b", event)
+
+	stream, err = client.Async().Emit(socket.Pack{Event: event})
+	assert.True(t, err == nil, err)
+	assert.True(t, string(stream.Data) == "a b", string(stream.Data))
+}
+
+func Test_Router_Remove_Name(t *testing.T) {
+
+	var router = &server.Router{}
+
+	router.Group("/user").Handler(func(handler *server.RouteHandler) {
+		handler.Route("/:id").Name("user").Handler(func(conn *server.Conn, stream *socket.Stream) error { return nil })
+	})
+
+	router.Remove("/user/:id")
+
+	_, err := router.URL("user", kitty.Params{Keys: []string{"id"}, Values: []string{"1"}})
+	assert.True(t, err != nil)
+
+	router.Route("/user/:id").Name("user").Handler(func(conn *server.Conn, stream *socket.Stream) error { return nil })
+
+	event, err := router.URL("user", kitty.Params{Keys: []string{"id"}, Values: []string{"1"}})
+	assert.True(t, err == nil && event == "/user/1", err)
+}
+
+func Test_Server_Panic(t *testing.T) {
+	var ch = make(chan error, 1)
+
+	tcpServer.OnError = func(err error) { ch <- err }
+	defer func() { tcpServer.OnError = func(err error) {} }()
+
+	assert.True(t, client.Emit(socket.Pack{Event: "/panic"}) == nil)
+
+	select {
+	case err := <-ch:
+		e, ok := err.(*kitty.PanicError)
+		assert.True(t, ok, err)
+		assert.True(t, e.Err == "route panic", e.Err)
+		assert.True(t, strings.Contains(e.Info, "client_test.go"), e.Info)
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	// the connection is still alive
+	stream, err := client.Async().JsonEmit(socket.JsonPack{Event: "/async"})
+	assert.True(t, err == nil, err)
+	assert.True(t, string(stream.Data) == `"async test"`, "stream is nil")
+}
+
+func Test_Server_Bind(t *testing.T) {
+
+	type user struct {
+		Name string `json:"name"`
+	}
+
+	stream, err := client.Async().JsonEmit(socket.JsonPack{Event: "/bind", Data: user{Name: "lemo"}})
+	assert.True(t, err == nil, err)
+	assert.True(t, string(stream.Data) == `"ok"`, string(stream.Data))
+
+	stream, err = client.Async().JsonEmit(socket.JsonPack{Event: "/bind", Data: user{Name: "l"}})
+	assert.True(t, err == nil, err)
+	assert.True(t, string(stream.Data) == `{"fields":[{"field":"Name","key":"name","rule":"min","param":"2","message":"must be at least 2"}]}`, string(stream.Data))
+}
+
 func Test_Client(t *testing.T) {
 
 	var id int64 = 123456789
@@ -192,6 +305,164 @@ func Test_Client(t *testing.T) {
 	}
 }
 
+func Test_Server_Shutdown_Drain(t *testing.T) {
+
+	var addr = "127.0.0.1:8670"
+
+	var started = make(chan struct{})
+
+	var srv = &server.Server{Addr: addr}
+	srv.OnOpen = func(conn *server.Conn) {}
+	srv.OnClose = func(conn *server.Conn) {}
+	srv.OnError = func(err error) {}
+	srv.OnSuccess = func() { close(started) }
+
+	var srvRouter = &server.Router{}
+	srvRouter.Route("/sleep").Handler(func(conn *server.Conn, stream *socket.Stream) error {
+		var d, _ = time.ParseDuration(string(stream.Data))
+		time.Sleep(d)
+		return conn.Emit(socket.Pack{Event: stream.Event, Data: stream.Data})
+	})
+
+	go srv.SetRouter(srvRouter).Start()
+	<-started
+
+	var replies = make(chan string, 2)
+
+	var connect = func() *Client {
+		var open = make(chan struct{})
+		var c = &Client{Addr: addr, HeartBeatInterval: time.Minute}
+		c.OnOpen = func(c *Client) { close(open) }
+		c.OnClose = func(c *Client) {}
+		c.OnError = func(err error) {}
+		var r = &Router{}
+		r.Route("/sleep").Handler(func(c *Client, stream *socket.Stream) error {
+			replies <- string(stream.Data)
+			return nil
+		})
+		go c.SetRouter(r).Connect()
+		<-open
+		return c
+	}
+
+	assert.True(t, connect().Emit(socket.Pack{Event: "/sleep", Data: []byte("200ms")}) == nil)
+	assert.True(t, connect().Emit(socket.Pack{Event: "/sleep", Data: []byte("3s")}) == nil)
+
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	report, err := srv.Shutdown(ctx)
+
+	assert.True(t, err == context.DeadlineExceeded, err)
+	assert.True(t, report.Drained == 1, report)
+	assert.True(t, report.Killed == 1, report)
+
+	select {
+	case reply := <-replies:
+		assert.True(t, reply == "200ms", reply)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+// newCert signs a certificate for name with ca, it is a self signed ca when ca is nil.
+func newCert(t *testing.T, name string, ca *x509.Certificate, caKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.True(t, err == nil, err)
+
+	var template = &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	if ca == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		ca, caKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	assert.True(t, err == nil, err)
+
+	cert, err := x509.ParseCertificate(der)
+	assert.True(t, err == nil, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.True(t, err == nil, err)
+
+	return cert, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func Test_Server_TLS(t *testing.T) {
+
+	var dir = t.TempDir()
+
+	var write = func(name string, bts []byte) string {
+		var file = filepath.Join(dir, name)
+		assert.True(t, ioutil.WriteFile(file, bts, 0600) == nil)
+		return file
+	}
+
+	ca, caKey, caPem, _ := newCert(t, "kitty-ca", nil, nil)
+	_, _, serverPem, serverKey := newCert(t, "kitty-server", ca, caKey)
+	_, _, clientPem, clientKey := newCert(t, "kitty-client", ca, caKey)
+
+	var caFile = write("ca.pem", caPem)
+
+	var addr = "127.0.0.1:8675"
+
+	var started = make(chan struct{})
+
+	var srv = &server.Server{Addr: addr, TLSOptions: &kitty.TLSOptions{
+		CertFile:     write("server.pem", serverPem),
+		KeyFile:      write("server.key", serverKey),
+		ClientCAFile: caFile,
+	}}
+	srv.OnOpen = func(conn *server.Conn) {}
+	srv.OnClose = func(conn *server.Conn) {}
+	srv.OnError = func(err error) {}
+	srv.OnSuccess = func() { close(started) }
+
+	var srvRouter = &server.Router{}
+	srvRouter.Route("/peer").Handler(func(conn *server.Conn, stream *socket.Stream) error {
+		return conn.Emit(socket.Pack{Event: stream.Event, Data: []byte(conn.PeerCertificate().Subject.CommonName), ID: stream.ID})
+	})
+
+	go srv.SetRouter(srvRouter).Start()
+	<-started
+	defer func() { _, _ = srv.Shutdown(context.Background()) }()
+
+	var open = make(chan struct{})
+
+	var c = &Client{Addr: addr, HeartBeatInterval: time.Minute, TLSOptions: &kitty.TLSOptions{
+		CertFile:   write("client.pem", clientPem),
+		KeyFile:    write("client.key", clientKey),
+		RootCAFile: caFile,
+	}}
+	c.OnOpen = func(c *Client) { close(open) }
+	c.OnClose = func(c *Client) {}
+	c.OnError = func(err error) {}
+
+	go c.SetRouter(&Router{}).Connect()
+	<-open
+	defer func() { _ = c.Close() }()
+
+	stream, err := c.Async().Emit(socket.Pack{Event: "/peer"})
+	assert.True(t, err == nil, err)
+	assert.True(t, string(stream.Data) == "kitty-client", string(stream.Data))
+}
+
 func Test_Shutdown(t *testing.T) {
 	shutdown()
 }
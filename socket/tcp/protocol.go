@@ -21,6 +21,7 @@ const HeadLen = 16
 
 var PingMessage = []byte{0x0, 0x0, 0x9, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0}
 var PongMessage = []byte{0x0, 0x0, 0xa, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0}
+var CloseMessage = []byte{0x0, 0x0, 0x4, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0}
 
 type Protocol interface {
 	Decode(message []byte) (messageType byte, id int64, route []byte, body []byte)
@@ -52,6 +53,8 @@ func (p *DefaultProtocol) Encode(messageType byte, id int64, route []byte, body
 		return PingMessage
 	case socket.Pong:
 		return PongMessage
+	case socket.Close:
+		return CloseMessage
 	}
 	return nil
 }
@@ -126,7 +129,7 @@ func isHeaderInvalid(message []byte) bool {
 	}
 
 	// message type
-	if message[2] != socket.Bin && message[2] != socket.Ping && message[2] != socket.Pong {
+	if message[2] != socket.Bin && message[2] != socket.Ping && message[2] != socket.Pong && message[2] != socket.Close {
 		return false
 	}
 
@@ -11,6 +11,8 @@
 package server
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"net"
 	"sync"
 
@@ -36,6 +38,20 @@ func (c *Conn) ClientIP() string {
 	return ""
 }
 
+// PeerCertificate returns the verified certificate of the client,
+// nil without TLS or client certificates.
+func (c *Conn) PeerCertificate() *x509.Certificate {
+	tlsConn, ok := c.Conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	var state = tlsConn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	return state.PeerCertificates[0]
+}
+
 func (c *Conn) Push(msg []byte) error {
 	return c.Server.Push(c.FD, msg)
 }
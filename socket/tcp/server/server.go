@@ -11,6 +11,8 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"net"
 	"sync"
@@ -43,6 +45,13 @@ type Server struct {
 	PingHandler       func(conn *Conn) func(appData string) error
 	PongHandler       func(conn *Conn) func(appData string) error
 	Protocol          tcp.Protocol
+	// TLSOptions serves TLS on every connection
+	TLSOptions *kitty.TLSOptions
+
+	// DisablePanicRecover lets a panic of a route or a middleware crash the process
+	DisablePanicRecover bool
+	// CloseOnPanic closes the connection after a panic is recovered
+	CloseOnPanic bool
 
 	fd          int64
 	connections map[int64]*Conn
@@ -50,6 +59,9 @@ type Server struct {
 	router      *Router
 	middle      []func(Middle) Middle
 	netListen   net.Listener
+	wg          sync.WaitGroup
+	closing     bool
+	tlsConfig   *tls.Config
 }
 
 type Middle func(conn *Conn, stream *socket.Stream)
@@ -194,9 +206,12 @@ func (s *Server) Ready() {
 	s.connections = make(map[int64]*Conn)
 }
 
-func (s *Server) onOpen(conn *Conn) {
-	s.addConnect(conn)
+func (s *Server) onOpen(conn *Conn) bool {
+	if !s.addConnect(conn) {
+		return false
+	}
 	s.OnOpen(conn)
+	return true
 }
 
 func (s *Server) onClose(conn *Conn) {
@@ -209,12 +224,16 @@ func (s *Server) onError(err error) {
 	s.OnError(err)
 }
 
-func (s *Server) addConnect(conn *Conn) {
+func (s *Server) addConnect(conn *Conn) bool {
 	s.mux.Lock()
 	defer s.mux.Unlock()
+	if s.closing {
+		return false
+	}
 	s.fd++
 	s.connections[s.fd] = conn
 	conn.FD = s.fd
+	return true
 }
 
 func (s *Server) delConnect(conn *Conn) {
@@ -262,12 +281,19 @@ func (s *Server) Start() {
 	var err error
 	var netListen net.Listener
 
-	netListen, err = net.Listen("tcp", s.Addr)
+	netListen, err = kitty.Listen("tcp", s.Addr)
 
 	if err != nil {
 		panic(err)
 	}
 
+	if s.TLSOptions != nil {
+		s.tlsConfig, err = s.TLSOptions.ServerConfig()
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	s.netListen = netListen
 
 	// start success
@@ -281,17 +307,84 @@ func (s *Server) Start() {
 			break
 		}
 
+		s.mux.Lock()
+		if s.closing {
+			s.mux.Unlock()
+			_ = conn.Close()
+			break
+		}
+		s.wg.Add(1)
+		s.mux.Unlock()
+
 		go s.process(conn)
 	}
 
 }
 
-func (s *Server) Shutdown() error {
-	return s.netListen.Close()
+// Shutdown stops accepting, sends a close frame to every connection and
+// closes it when its handler finishes. Connections still open when ctx
+// is done are killed.
+func (s *Server) Shutdown(ctx context.Context) (kitty.ShutdownReport, error) {
+
+	var report kitty.ShutdownReport
+
+	if s.TLSOptions != nil {
+		s.TLSOptions.Close()
+	}
+
+	s.mux.Lock()
+	s.closing = true
+	var conns = make([]*Conn, 0, len(s.connections))
+	for _, conn := range s.connections {
+		conns = append(conns, conn)
+	}
+	s.mux.Unlock()
+
+	var err = s.netListen.Close()
+
+	var closeMessage = s.Protocol.Encode(socket.Close, 0, nil, nil)
+
+	for i := 0; i < len(conns); i++ {
+		if closeMessage != nil {
+			_, _ = conns[i].Write(closeMessage)
+		}
+		// wake up the read loop, it breaks after the current message
+		_ = conns[i].Conn.SetReadDeadline(time.Now())
+	}
+
+	var done = make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		for i := 0; i < len(conns); i++ {
+			if _, ok := s.GetConnection(conns[i].FD); ok {
+				report.Killed++
+				_ = conns[i].Close()
+			}
+		}
+		err = ctx.Err()
+	}
+
+	report.Drained = len(conns) - report.Killed
+
+	return report, err
+}
+
+func (s *Server) isClosing() bool {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.closing
 }
 
 func (s *Server) process(netConn net.Conn) {
 
+	defer s.wg.Done()
+
 	// 超时时间
 	err := netConn.SetReadDeadline(time.Now().Add(s.HeartBeatTimeout))
 	if err != nil {
@@ -309,13 +402,26 @@ func (s *Server) process(netConn net.Conn) {
 		panic(err)
 	}
 
+	if s.tlsConfig != nil {
+		var tlsConn = tls.Server(netConn, s.tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			s.onError(err)
+			_ = netConn.Close()
+			return
+		}
+		netConn = tlsConn
+	}
+
 	var conn = &Conn{
 		FD:     0,
 		Conn:   netConn,
 		Server: s,
 	}
 
-	s.onOpen(conn)
+	if !s.onOpen(conn) {
+		_ = netConn.Close()
+		return
+	}
 
 	var reader = s.Protocol.Reader()
 
@@ -339,6 +445,10 @@ func (s *Server) process(netConn net.Conn) {
 			break
 		}
 
+		if s.isClosing() {
+			break
+		}
+
 	}
 
 	s.onClose(conn)
@@ -369,6 +479,11 @@ func (s *Server) decodeMessage(conn *Conn, message []byte) error {
 		return s.PongHandler(conn)("")
 	}
 
+	// Close
+	if messageType == socket.Close {
+		return conn.Close()
+	}
+
 	// on router
 	s.middleware(conn, &socket.Stream{Pack: socket.Pack{Event: string(route), Data: body, ID: id}})
 
@@ -376,6 +491,7 @@ func (s *Server) decodeMessage(conn *Conn, message []byte) error {
 }
 
 func (s *Server) middleware(conn *Conn, stream *socket.Stream) {
+	defer s.recover(conn, "")
 	var next Middle = s.handler
 	for i := len(s.middle) - 1; i >= 0; i-- {
 		next = s.middle[i](next)
@@ -402,6 +518,8 @@ func (s *Server) handler(conn *Conn, stream *socket.Stream) {
 
 	var nodeData = n.Data.(*node)
 
+	defer s.recover(conn, nodeData.Info)
+
 	stream.Params = kitty.Params{Keys: n.Keys, Values: n.ParseParams(formatPath)}
 
 	for i := 0; i < len(nodeData.Before); i++ {
@@ -432,6 +550,23 @@ func (s *Server) handler(conn *Conn, stream *socket.Stream) {
 
 }
 
+// recover reports a panic as a *kitty.PanicError through OnError.
+func (s *Server) recover(conn *Conn, info string) {
+	if s.DisablePanicRecover {
+		return
+	}
+	var err = recover()
+	if err == nil {
+		return
+	}
+	if s.OnError != nil {
+		s.OnError(kitty.NewPanicError(err, info))
+	}
+	if s.CloseOnPanic {
+		_ = conn.Close()
+	}
+}
+
 func (s *Server) SetRouter(router *Router) *Server {
 	s.router = router
 	return s
@@ -53,6 +53,11 @@ type Client struct {
 
 	Protocol udp.Protocol
 
+	// DisablePanicRecover lets a panic of a route or a middleware crash the process
+	DisablePanicRecover bool
+	// CloseOnPanic closes the connection after a panic is recovered
+	CloseOnPanic bool
+
 	router                *Router
 	middle                []func(Middle) Middle
 	mux                   sync.RWMutex
@@ -400,6 +405,7 @@ func (c *Client) decodeMessage(message []byte) error {
 }
 
 func (c *Client) middleware(conn *Client, stream *socket.Stream) {
+	defer c.recover(conn, "")
 	var next Middle = c.handler
 	for i := len(c.middle) - 1; i >= 0; i-- {
 		next = c.middle[i](next)
@@ -426,6 +432,8 @@ func (c *Client) handler(conn *Client, stream *socket.Stream) {
 
 	var nodeData = n.Data.(*node)
 
+	defer c.recover(conn, nodeData.Info)
+
 	stream.Params = kitty.Params{Keys: n.Keys, Values: n.ParseParams(formatPath)}
 
 	for i := 0; i < len(nodeData.Before); i++ {
@@ -456,6 +464,23 @@ func (c *Client) handler(conn *Client, stream *socket.Stream) {
 
 }
 
+// recover reports a panic as a *kitty.PanicError through OnError.
+func (c *Client) recover(conn *Client, info string) {
+	if c.DisablePanicRecover {
+		return
+	}
+	var err = recover()
+	if err == nil {
+		return
+	}
+	if c.OnError != nil {
+		c.OnError(kitty.NewPanicError(err, info))
+	}
+	if c.CloseOnPanic {
+		_ = conn.Close()
+	}
+}
+
 func (c *Client) SetRouter(router *Router) *Client {
 	c.router = router
 	return c
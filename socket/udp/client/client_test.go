@@ -11,6 +11,7 @@
 package client
 
 import (
+	"context"
 	"strings"
 	"sync"
 	"testing"
@@ -128,7 +129,7 @@ func TestMain(t *testing.M) {
 		<-stop
 
 		_ = client.Close()
-		_ = udpServer.Shutdown()
+		_, _ = udpServer.Shutdown(context.Background())
 
 	}()
 
@@ -31,6 +31,9 @@ type Conn struct {
 	tick   *time.Timer
 	accept chan []byte
 	close  chan struct{}
+	// messages accepted but not handled yet
+	pending int32
+	wg      sync.WaitGroup
 }
 
 func (c *Conn) Host() string {
@@ -11,13 +11,15 @@
 package server
 
 import (
+	"errors"
 	"strconv"
 	"strings"
 
 	"github.com/lemoyxk/caller"
-	"github.com/lemoyxk/structure/tire"
 
+	"github.com/lemoyxk/kitty"
 	"github.com/lemoyxk/kitty/socket"
+	"github.com/lemoyxk/kitty/tire"
 )
 
 type groupFunction func(handler *RouteHandler)
@@ -46,7 +48,7 @@ func (g *group) After(after ...After) *group {
 }
 
 func (g *group) Remove(path string) {
-	g.router.tire.Delete(g.path + path)
+	g.router.remove(g.path + path)
 }
 
 func (g *group) Handler(fn groupFunction) {
@@ -62,11 +64,12 @@ func (rh *RouteHandler) Route(path string) *route {
 }
 
 func (rh *RouteHandler) Remove(path string) {
-	rh.group.router.tire.Delete(rh.group.path + path)
+	rh.group.router.remove(rh.group.path + path)
 }
 
 type route struct {
 	path        string
+	name        string
 	before      []Before
 	after       []After
 	socket      *Server
@@ -77,6 +80,11 @@ type route struct {
 	group       *group
 }
 
+func (r *route) Name(name string) *route {
+	r.name = name
+	return r
+}
+
 func (r *route) Before(before ...Before) *route {
 	r.before = append(r.before, before...)
 	return r
@@ -124,6 +132,10 @@ func (r *route) Handler(fn function) {
 
 	var path = router.formatPath(g.path + r.path)
 
+	if _, ok := router.names[r.name]; ok && r.name != "" {
+		panic("route name " + r.name + " is exists")
+	}
+
 	if router.tire == nil {
 		router.tire = new(tire.Tire)
 	}
@@ -132,6 +144,8 @@ func (r *route) Handler(fn function) {
 
 	wba.Info = file + ":" + strconv.Itoa(line)
 
+	wba.Name = r.name
+
 	wba.Function = fn
 
 	wba.Before = append(g.before, r.before...)
@@ -155,12 +169,25 @@ func (r *route) Handler(fn function) {
 
 	wba.Route = []byte(path)
 
-	router.tire.Insert(path, wba)
+	if err := router.tire.Insert(path, wba); err != nil {
+		if e, ok := err.(*tire.ConflictError); ok {
+			panic(path + " (" + wba.Info + ") is conflict with " + e.Conflict.Data.(*node).Info)
+		}
+		panic(err)
+	}
 
+	// the name is kept only when the route is added
+	if r.name != "" {
+		if router.names == nil {
+			router.names = make(map[string]string)
+		}
+		router.names[r.name] = g.path + r.path
+	}
 }
 
 type Router struct {
 	tire         *tire.Tire
+	names        map[string]string
 	IgnoreCase   bool
 	globalAfter  []After
 	globalBefore []Before
@@ -186,13 +213,37 @@ func (r *Router) Group(path ...string) *group {
 }
 
 func (r *Router) Remove(path ...string) {
-	r.tire.Delete(strings.Join(path, ""))
+	r.remove(strings.Join(path, ""))
+}
+
+// remove deletes the route of path and its names.
+func (r *Router) remove(path string) {
+	if r.tire == nil {
+		return
+	}
+	path = r.formatPath(path)
+	r.tire.Delete(path)
+	for name, p := range r.names {
+		if r.formatPath(p) == path {
+			delete(r.names, name)
+		}
+	}
 }
 
 func (r *Router) Route(path string) *route {
 	return (&RouteHandler{group: r.Group("")}).Route(path)
 }
 
+// URL builds the event of a named route, every param of the route
+// must be given. The params are not escaped, the event is matched as it is.
+func (r *Router) URL(name string, params kitty.Params) (string, error) {
+	var path, ok = r.names[name]
+	if !ok {
+		return "", errors.New("route name " + name + " not found")
+	}
+	return tire.BuildRaw(path, params.Keys, params.Values)
+}
+
 func (r *Router) GetAllRouters() []*node {
 	var res []*node
 	var tires = r.tire.GetAllValue()
@@ -223,13 +274,14 @@ func (r *Router) getRoute(path string) (*tire.Tire, []byte) {
 
 func (r *Router) formatPath(path string) string {
 	if r.IgnoreCase {
-		path = strings.ToLower(path)
+		path = tire.Lower(path)
 	}
 	return path
 }
 
 type node struct {
 	Info     string
+	Name     string
 	Route    []byte
 	Function function
 	Before   []Before
@@ -11,9 +11,11 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/protobuf/proto"
@@ -45,6 +47,11 @@ type Server struct {
 	PongHandler func(conn *Conn) func(appData string) error
 	Protocol    udp.Protocol
 
+	// DisablePanicRecover lets a panic of a route or a middleware crash the process
+	DisablePanicRecover bool
+	// CloseOnPanic closes the connection after a panic is recovered
+	CloseOnPanic bool
+
 	fd          int64
 	connections map[int64]*Conn
 	addrMap     map[string]int64
@@ -53,6 +60,7 @@ type Server struct {
 	middle      []func(Middle) Middle
 	netListen   *net.UDPConn
 	processLock sync.RWMutex
+	closing     bool
 }
 
 type Middle func(conn *Conn, stream *socket.Stream)
@@ -208,7 +216,10 @@ func (s *Server) onOpen(conn *Conn) {
 func (s *Server) onClose(conn *Conn) {
 	s.delConnect(conn)
 	s.OnClose(conn)
-	conn.close <- struct{}{}
+	select {
+	case conn.close <- struct{}{}:
+	default:
+	}
 }
 
 func (s *Server) onError(err error) {
@@ -278,18 +289,17 @@ func (s *Server) Start() {
 	if addr.IP.IsMulticast() {
 		netListen, err = net.ListenMulticastUDP("udp", nil, addr)
 	} else {
-		netListen, err = net.ListenUDP("udp", addr)
+		var conn net.PacketConn
+		conn, err = kitty.ListenPacket("udp", s.Addr)
+		if err == nil {
+			netListen = conn.(*net.UDPConn)
+		}
 	}
 
 	if err != nil {
 		panic(err)
 	}
 
-	// netListen, err = net.ListenUDP("udp", addr)
-	// if err != nil {
-	// 	panic(err)
-	// }
-
 	s.netListen = netListen
 
 	// start success
@@ -317,8 +327,57 @@ func (s *Server) Start() {
 
 }
 
-func (s *Server) Shutdown() error {
-	return s.netListen.Close()
+// Shutdown stops accepting new connections and new messages, waits for
+// the handlers of every connection then sends it a close frame.
+// Connections still busy when ctx is done are killed.
+func (s *Server) Shutdown(ctx context.Context) (kitty.ShutdownReport, error) {
+
+	var report kitty.ShutdownReport
+
+	s.processLock.Lock()
+	s.mux.Lock()
+	s.closing = true
+	var conns = make([]*Conn, 0, len(s.connections))
+	for _, conn := range s.connections {
+		conns = append(conns, conn)
+	}
+	s.mux.Unlock()
+	s.processLock.Unlock()
+
+	var err error
+
+	var done = make(chan struct{})
+	go func() {
+		for i := 0; i < len(conns); i++ {
+			conns[i].wg.Wait()
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	for i := 0; i < len(conns); i++ {
+		if _, ok := s.GetConnection(conns[i].FD); !ok {
+			continue
+		}
+		if atomic.LoadInt32(&conns[i].pending) > 0 {
+			report.Killed++
+		}
+		_ = conns[i].Close()
+		s.onClose(conns[i])
+	}
+
+	report.Drained = len(conns) - report.Killed
+
+	if e := s.netListen.Close(); err == nil {
+		err = e
+	}
+
+	return report, err
 }
 
 func (s *Server) process(addr *net.UDPAddr, message []byte) {
@@ -330,21 +389,28 @@ func (s *Server) process(addr *net.UDPAddr, message []byte) {
 
 	switch message[2] {
 	case socket.Bin, socket.Ping, socket.Pong:
-		if !ok {
+		if !ok || s.closing {
 			return
 		}
+		conn.wg.Add(1)
+		atomic.AddInt32(&conn.pending, 1)
 		conn.accept <- message
 	case socket.Open:
 		if ok {
 			return
 		}
 
+		if s.closing {
+			_, _ = s.netListen.WriteToUDP(udp.CloseMessage, addr)
+			return
+		}
+
 		var conn = &Conn{
 			FD:     0,
 			Conn:   addr,
 			Server: s,
 			accept: make(chan []byte, 128),
-			close:  make(chan struct{}),
+			close:  make(chan struct{}, 1),
 		}
 
 		conn.tick = time.NewTimer(s.HeartBeatTimeout)
@@ -367,9 +433,20 @@ func (s *Server) process(addr *net.UDPAddr, message []byte) {
 					if err != nil {
 						s.OnError(err)
 					}
+					atomic.AddInt32(&conn.pending, -1)
+					conn.wg.Done()
 				case <-conn.close:
 					conn.tick.Stop()
-					break
+					// drop the messages left
+					for {
+						select {
+						case <-conn.accept:
+							atomic.AddInt32(&conn.pending, -1)
+							conn.wg.Done()
+						default:
+							return
+						}
+					}
 				}
 			}
 		}()
@@ -424,6 +501,7 @@ func (s *Server) decodeMessage(conn *Conn, message []byte) error {
 }
 
 func (s *Server) middleware(conn *Conn, stream *socket.Stream) {
+	defer s.recover(conn, "")
 	var next Middle = s.handler
 	for i := len(s.middle) - 1; i >= 0; i-- {
 		next = s.middle[i](next)
@@ -450,6 +528,8 @@ func (s *Server) handler(conn *Conn, stream *socket.Stream) {
 
 	var nodeData = n.Data.(*node)
 
+	defer s.recover(conn, nodeData.Info)
+
 	stream.Params = kitty.Params{Keys: n.Keys, Values: n.ParseParams(formatPath)}
 
 	for i := 0; i < len(nodeData.Before); i++ {
@@ -480,6 +560,23 @@ func (s *Server) handler(conn *Conn, stream *socket.Stream) {
 
 }
 
+// recover reports a panic as a *kitty.PanicError through OnError.
+func (s *Server) recover(conn *Conn, info string) {
+	if s.DisablePanicRecover {
+		return
+	}
+	var err = recover()
+	if err == nil {
+		return
+	}
+	if s.OnError != nil {
+		s.OnError(kitty.NewPanicError(err, info))
+	}
+	if s.CloseOnPanic {
+		_ = conn.Close()
+	}
+}
+
 func (s *Server) SetRouter(router *Router) *Server {
 	s.router = router
 	return s
@@ -35,6 +35,8 @@ type Client struct {
 	WriteBufferSize   int
 	ReadBufferSize    int
 	DailTimeout       time.Duration
+	// Header is sent with the upgrade request, like a Cookie
+	Header http.Header
 
 	OnOpen         func(client *Client)
 	OnClose        func(client *Client)
@@ -49,6 +51,11 @@ type Client struct {
 
 	Protocol websocket2.Protocol
 
+	// DisablePanicRecover lets a panic of a route or a middleware crash the process
+	DisablePanicRecover bool
+	// CloseOnPanic closes the connection after a panic is recovered
+	CloseOnPanic bool
+
 	mux                   sync.RWMutex
 	router                *Router
 	middle                []func(Middle) Middle
@@ -182,7 +189,7 @@ func (c *Client) Connect() {
 	}
 
 	// 连接服务器
-	handler, response, err := dialer.Dial(c.Scheme+"://"+c.Addr+c.Path, nil)
+	handler, response, err := dialer.Dial(c.Scheme+"://"+c.Addr+c.Path, c.Header)
 	if err != nil {
 		c.OnError(err)
 		c.reconnecting()
@@ -351,6 +358,7 @@ func (c *Client) decodeMessage(messageFrame int, message []byte) error {
 }
 
 func (c *Client) middleware(conn *Client, stream *socket.Stream) {
+	defer c.recover(conn, "")
 	var next Middle = c.handler
 	for i := len(c.middle) - 1; i >= 0; i-- {
 		next = c.middle[i](next)
@@ -377,6 +385,8 @@ func (c *Client) handler(conn *Client, stream *socket.Stream) {
 
 	var nodeData = n.Data.(*node)
 
+	defer c.recover(conn, nodeData.Info)
+
 	stream.Params = kitty.Params{Keys: n.Keys, Values: n.ParseParams(formatPath)}
 
 	for i := 0; i < len(nodeData.Before); i++ {
@@ -407,6 +417,23 @@ func (c *Client) handler(conn *Client, stream *socket.Stream) {
 
 }
 
+// recover reports a panic as a *kitty.PanicError through OnError.
+func (c *Client) recover(conn *Client, info string) {
+	if c.DisablePanicRecover {
+		return
+	}
+	var err = recover()
+	if err == nil {
+		return
+	}
+	if c.OnError != nil {
+		c.OnError(kitty.NewPanicError(err, info))
+	}
+	if c.CloseOnPanic {
+		_ = conn.Close()
+	}
+}
+
 func (c *Client) SetRouter(router *Router) *Client {
 	c.router = router
 	return c
@@ -11,6 +11,8 @@
 package client
 
 import (
+	"context"
+	"net/http"
 	"strings"
 	"sync"
 	"testing"
@@ -99,6 +101,14 @@ func initServer(fn func()) {
 		})
 	})
 
+	webSocketServerRouter.Route("/cookie").Handler(func(conn *server.Conn, stream *socket.Stream) error {
+		return ServerJson(conn, JsonPack{
+			Event: "/cookie",
+			Data:  conn.Cookie("kitty_session"),
+			ID:    stream.ID,
+		})
+	})
+
 	go webSocketServer.SetRouter(webSocketServerRouter).Start()
 
 	webSocketServer.OnSuccess = func() {
@@ -110,6 +120,9 @@ func initClient(fn func()) {
 	// create client
 	client = &Client{Scheme: "ws", Addr: addr, ReconnectInterval: time.Second, HeartBeatInterval: time.Second}
 
+	// the session of the http server
+	client.Header = http.Header{"Cookie": {"kitty_session=abc"}}
+
 	// event
 	client.OnClose = func(c *Client) {}
 	client.OnOpen = func(c *Client) {}
@@ -159,7 +172,7 @@ func TestMain(t *testing.M) {
 		<-stop
 
 		_ = client.Close()
-		_ = webSocketServer.Shutdown()
+		_, _ = webSocketServer.Shutdown(context.Background())
 	}()
 
 	for {
@@ -184,6 +197,12 @@ func Test_Client_Async(t *testing.T) {
 	assert.True(t, string(stream.Data) == "async test", "stream is nil")
 }
 
+func Test_Conn_Cookie(t *testing.T) {
+	stream, err := client.Async().JsonEmit(socket.JsonPack{Event: "/cookie"})
+	assert.True(t, err == nil, err)
+	assert.True(t, string(stream.Data) == "abc", string(stream.Data))
+}
+
 func Test_Client(t *testing.T) {
 
 	var id int64 = 123456
@@ -11,6 +11,7 @@
 package server
 
 import (
+	"crypto/x509"
 	"net"
 	"net/http"
 	"strings"
@@ -56,6 +57,25 @@ func (c *Conn) ClientIP() string {
 	return ""
 }
 
+// Cookie returns the cookie of the upgrade request, like the session id,
+// empty without it.
+func (c *Conn) Cookie(name string) string {
+	cookie, err := c.Request.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// PeerCertificate returns the verified certificate of the client,
+// nil without TLS or client certificates.
+func (c *Conn) PeerCertificate() *x509.Certificate {
+	if c.Request.TLS == nil || len(c.Request.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return c.Request.TLS.PeerCertificates[0]
+}
+
 func (c *Conn) Push(msg []byte) error {
 	return c.Server.Push(c.FD, msg)
 }
@@ -11,6 +11,9 @@ import (
 
 	"github.com/json-iterator/go"
 
+	h2 "golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
 	"github.com/lemoyxk/kitty"
 	"github.com/lemoyxk/kitty/socket"
 	websocket2 "github.com/lemoyxk/kitty/socket/websocket"
@@ -31,6 +34,9 @@ type Server struct {
 	CertFile string
 	// TLS KEY
 	KeyFile string
+	// TLSOptions replaces TLS, CertFile and KeyFile,
+	// it supports SNI, client certificates and reload.
+	TLSOptions *kitty.TLSOptions
 
 	OnClose   func(conn *Conn)
 	OnMessage func(conn *Conn, msg []byte)
@@ -46,10 +52,35 @@ type Server struct {
 	WriteBufferSize   int
 	CheckOrigin       func(r *http.Request) bool
 
+	// ReadTimeout and WriteTimeout only apply to the upgrade request,
+	// they are 0 by default.
+	ReadTimeout time.Duration
+	// ReadHeaderTimeout is 10s by default.
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	// IdleTimeout is 120s by default.
+	IdleTimeout time.Duration
+	// MaxHeaderBytes is 1MB by default.
+	MaxHeaderBytes int
+	// ConnState is called when a client connection changes state.
+	ConnState func(conn net.Conn, state http.ConnState)
+	// Logger receives the errors of net/http, they go to stderr if it is nil.
+	Logger kitty.Logger
+	// H2C serves HTTP/2 without TLS, by prior knowledge or by upgrade.
+	H2C bool
+	// HTTP2 tunes HTTP/2 with TLS or H2C, like MaxConcurrentStreams
+	// and MaxReadFrameSize.
+	HTTP2 *h2.Server
+
 	PingHandler func(conn *Conn) func(appData string) error
 	PongHandler func(conn *Conn) func(appData string) error
 	Protocol    websocket2.Protocol
 
+	// DisablePanicRecover lets a panic of a route or a middleware crash the process
+	DisablePanicRecover bool
+	// CloseOnPanic closes the connection after a panic is recovered
+	CloseOnPanic bool
+
 	upgrade websocket.Upgrader
 
 	fd          int64
@@ -59,6 +90,8 @@ type Server struct {
 	middle      []func(next Middle) Middle
 	server      *http.Server
 	netListen   net.Listener
+	wg          sync.WaitGroup
+	closing     bool
 }
 
 type Middle func(conn *Conn, stream *socket.Stream)
@@ -141,12 +174,16 @@ func (s *Server) ProtoBufEmitAll(msg socket.ProtoBufPack) (int, int) {
 	return counter, success
 }
 
-func (s *Server) addConnect(conn *Conn) {
+func (s *Server) addConnect(conn *Conn) bool {
 	s.mux.Lock()
 	defer s.mux.Unlock()
+	if s.closing {
+		return false
+	}
 	s.fd++
 	s.connections[s.fd] = conn
 	conn.FD = s.fd
+	return true
 }
 
 func (s *Server) delConnect(conn *Conn) {
@@ -187,9 +224,12 @@ func (s *Server) Close(fd int64) error {
 	return conn.Close()
 }
 
-func (s *Server) onOpen(conn *Conn) {
-	s.addConnect(conn)
+func (s *Server) onOpen(conn *Conn) bool {
+	if !s.addConnect(conn) {
+		return false
+	}
 	s.OnOpen(conn)
+	return true
 }
 
 func (s *Server) onClose(conn *Conn) {
@@ -212,6 +252,10 @@ func (s *Server) Ready() {
 		panic("Addr must set")
 	}
 
+	if s.TLS && s.TLSOptions == nil {
+		s.TLSOptions = &kitty.TLSOptions{CertFile: s.CertFile, KeyFile: s.KeyFile}
+	}
+
 	if s.HeartBeatTimeout == 0 {
 		s.HeartBeatTimeout = 30 * time.Second
 	}
@@ -224,6 +268,18 @@ func (s *Server) Ready() {
 		s.HandshakeTimeout = 2 * time.Second
 	}
 
+	if s.ReadHeaderTimeout == 0 {
+		s.ReadHeaderTimeout = 10 * time.Second
+	}
+
+	if s.IdleTimeout == 0 {
+		s.IdleTimeout = 120 * time.Second
+	}
+
+	if s.MaxHeaderBytes == 0 {
+		s.MaxHeaderBytes = http.DefaultMaxHeaderBytes
+	}
+
 	// suggest 4096
 	if s.ReadBufferSize == 0 {
 		s.ReadBufferSize = 1024
@@ -292,6 +348,17 @@ func (s *Server) Ready() {
 
 func (s *Server) process(w http.ResponseWriter, r *http.Request) {
 
+	s.mux.Lock()
+	if s.closing {
+		s.mux.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	s.wg.Add(1)
+	s.mux.Unlock()
+
+	defer s.wg.Done()
+
 	// 升级协议
 	netConn, err := s.upgrade.Upgrade(w, r, nil)
 
@@ -323,7 +390,10 @@ func (s *Server) process(w http.ResponseWriter, r *http.Request) {
 	netConn.SetPongHandler(s.PongHandler(conn))
 
 	// 打开连接 记录
-	s.onOpen(conn)
+	if !s.onOpen(conn) {
+		_ = netConn.Close()
+		return
+	}
 
 	// 收到消息 处理 单一连接接受不冲突 但是不能并发写入
 	for {
@@ -387,6 +457,7 @@ func (s *Server) decodeMessage(conn *Conn, message []byte) error {
 }
 
 func (s *Server) middleware(conn *Conn, stream *socket.Stream) {
+	defer s.recover(conn, "")
 	var next Middle = s.handler
 	for i := len(s.middle) - 1; i >= 0; i-- {
 		next = s.middle[i](next)
@@ -413,6 +484,8 @@ func (s *Server) handler(conn *Conn, stream *socket.Stream) {
 
 	var nodeData = n.Data.(*node)
 
+	defer s.recover(conn, nodeData.Info)
+
 	stream.Params = kitty.Params{Keys: n.Keys, Values: n.ParseParams(formatPath)}
 
 	for i := 0; i < len(nodeData.Before); i++ {
@@ -443,6 +516,23 @@ func (s *Server) handler(conn *Conn, stream *socket.Stream) {
 
 }
 
+// recover reports a panic as a *kitty.PanicError through OnError.
+func (s *Server) recover(conn *Conn, info string) {
+	if s.DisablePanicRecover {
+		return
+	}
+	var err = recover()
+	if err == nil {
+		return
+	}
+	if s.OnError != nil {
+		s.OnError(kitty.NewPanicError(err, info))
+	}
+	if s.CloseOnPanic {
+		_ = conn.Close()
+	}
+}
+
 func (s *Server) SetRouter(router *Router) *Server {
 	s.router = router
 	return s
@@ -456,12 +546,45 @@ func (s *Server) Start() {
 
 	s.Ready()
 
-	var server = http.Server{Addr: s.Addr, Handler: s}
+	var server = http.Server{
+		Addr:              s.Addr,
+		Handler:           s,
+		ReadTimeout:       s.ReadTimeout,
+		ReadHeaderTimeout: s.ReadHeaderTimeout,
+		WriteTimeout:      s.WriteTimeout,
+		IdleTimeout:       s.IdleTimeout,
+		MaxHeaderBytes:    s.MaxHeaderBytes,
+		ConnState:         s.ConnState,
+	}
+
+	if s.Logger != nil {
+		server.ErrorLog = kitty.NewErrorLog(s.Logger)
+	}
+
+	var h2s = s.HTTP2
+	if h2s == nil {
+		h2s = &h2.Server{}
+	}
+
+	if s.H2C {
+		server.Handler = h2c.NewHandler(s, h2s)
+	}
+
+	if s.TLSOptions != nil {
+		config, err := s.TLSOptions.ServerConfig()
+		if err != nil {
+			panic(err)
+		}
+		server.TLSConfig = config
+		if err := h2.ConfigureServer(&server, h2s); err != nil {
+			panic(err)
+		}
+	}
 
 	var err error
 	var netListen net.Listener
 
-	netListen, err = net.Listen("tcp", server.Addr)
+	netListen, err = kitty.Listen("tcp", server.Addr)
 
 	if err != nil {
 		panic(err)
@@ -475,8 +598,8 @@ func (s *Server) Start() {
 		s.OnSuccess()
 	}
 
-	if s.TLS {
-		err = server.ServeTLS(netListen, s.CertFile, s.KeyFile)
+	if s.TLSOptions != nil {
+		err = server.ServeTLS(netListen, "", "")
 	} else {
 		err = server.Serve(netListen)
 	}
@@ -486,8 +609,54 @@ func (s *Server) Start() {
 	}
 }
 
-func (s *Server) Shutdown() error {
-	return s.server.Shutdown(context.Background())
+// Shutdown stops accepting, sends a close frame to every connection and
+// waits for the client to close it. Connections still open when ctx
+// is done are killed.
+func (s *Server) Shutdown(ctx context.Context) (kitty.ShutdownReport, error) {
+
+	var report kitty.ShutdownReport
+
+	if s.TLSOptions != nil {
+		s.TLSOptions.Close()
+	}
+
+	s.mux.Lock()
+	s.closing = true
+	var conns = make([]*Conn, 0, len(s.connections))
+	for _, conn := range s.connections {
+		conns = append(conns, conn)
+	}
+	s.mux.Unlock()
+
+	var err = s.server.Shutdown(ctx)
+
+	var closeMessage = websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutdown")
+
+	for i := 0; i < len(conns); i++ {
+		_ = conns[i].Conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+	}
+
+	var done = make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		for i := 0; i < len(conns); i++ {
+			if _, ok := s.GetConnection(conns[i].FD); ok {
+				report.Killed++
+				_ = conns[i].Close()
+			}
+		}
+		err = ctx.Err()
+	}
+
+	report.Drained = len(conns) - report.Killed
+
+	return report, err
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
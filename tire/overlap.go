@@ -0,0 +1,170 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-05 11:30
+**/
+
+package tire
+
+import (
+	"regexp/syntax"
+	"unicode"
+)
+
+// overlap reports whether a value can match the two constraints.
+// The regexps run side by side, they overlap when both of them
+// match after the same runes. Empty width assertions are passed.
+func overlap(a string, b string) bool {
+
+	pa, err := compile(a)
+	if err != nil {
+		return true
+	}
+
+	pb, err := compile(b)
+	if err != nil {
+		return true
+	}
+
+	type state struct {
+		a, b     uint32
+		consumed bool
+	}
+
+	var seen = make(map[state]bool)
+
+	var queue []state
+
+	var push = func(as []uint32, bs []uint32, consumed bool) {
+		for i := 0; i < len(as); i++ {
+			for j := 0; j < len(bs); j++ {
+				var s = state{a: as[i], b: bs[j], consumed: consumed}
+				if !seen[s] {
+					seen[s] = true
+					queue = append(queue, s)
+				}
+			}
+		}
+	}
+
+	push(closure(pa, uint32(pa.Start)), closure(pb, uint32(pb.Start)), false)
+
+	for len(queue) > 0 {
+
+		var s = queue[0]
+		queue = queue[1:]
+
+		var ia, ib = &pa.Inst[s.a], &pb.Inst[s.b]
+
+		// a param is never empty
+		if ia.Op == syntax.InstMatch && ib.Op == syntax.InstMatch {
+			if s.consumed {
+				return true
+			}
+			continue
+		}
+
+		if ia.Op == syntax.InstMatch || ib.Op == syntax.InstMatch || !sameRune(ia, ib) {
+			continue
+		}
+
+		push(closure(pa, ia.Out), closure(pb, ib.Out), true)
+	}
+
+	return false
+}
+
+// pattern returns the regexp of a constraint.
+func pattern(constraint string) string {
+	if p, ok := patterns[constraint]; ok {
+		return p
+	}
+	return constraint
+}
+
+func compile(expr string) (*syntax.Prog, error) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	return syntax.Compile(re.Simplify())
+}
+
+// closure returns the instructions that match a rune or the end,
+// they are reached from pc without a rune.
+func closure(p *syntax.Prog, pc uint32) []uint32 {
+
+	var res []uint32
+
+	var seen = make(map[uint32]bool)
+
+	var walk func(pc uint32)
+
+	walk = func(pc uint32) {
+
+		if seen[pc] {
+			return
+		}
+
+		seen[pc] = true
+
+		var inst = &p.Inst[pc]
+
+		switch inst.Op {
+		case syntax.InstAlt, syntax.InstAltMatch:
+			walk(inst.Out)
+			walk(inst.Arg)
+		case syntax.InstCapture, syntax.InstNop, syntax.InstEmptyWidth:
+			walk(inst.Out)
+		case syntax.InstFail:
+		default:
+			res = append(res, pc)
+		}
+	}
+
+	walk(pc)
+
+	return res
+}
+
+// sameRune reports whether a rune matches the two instructions,
+// the bounds of their ranges are enough to find it.
+func sameRune(a *syntax.Inst, b *syntax.Inst) bool {
+
+	var candidates = []rune{'a'}
+
+	var runes = append(append([]rune(nil), a.Rune...), b.Rune...)
+
+	for i := 0; i < len(runes); i++ {
+		candidates = append(candidates, runes[i])
+		for r := unicode.SimpleFold(runes[i]); r != runes[i]; r = unicode.SimpleFold(r) {
+			candidates = append(candidates, r)
+		}
+	}
+
+	for i := 0; i < len(candidates); i++ {
+		if matchRune(a, candidates[i]) && matchRune(b, candidates[i]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchRune(inst *syntax.Inst, r rune) bool {
+	switch inst.Op {
+	case syntax.InstRune:
+		return inst.MatchRune(r)
+	case syntax.InstRune1:
+		return r == inst.Rune[0]
+	case syntax.InstRuneAny:
+		return true
+	case syntax.InstRuneAnyNotNL:
+		return r != '\n'
+	}
+	return false
+}
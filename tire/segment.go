@@ -0,0 +1,235 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-05 10:40
+**/
+
+package tire
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type kind byte
+
+const (
+	staticKind kind = iota
+	constrainedKind
+	paramKind
+	wildcardKind
+)
+
+var types = map[string]func(string) bool{
+	"int": func(s string) bool {
+		_, err := strconv.ParseInt(s, 10, 64)
+		return err == nil
+	},
+	"uint": func(s string) bool {
+		_, err := strconv.ParseUint(s, 10, 64)
+		return err == nil
+	},
+	"float": func(s string) bool {
+		_, err := strconv.ParseFloat(s, 64)
+		return err == nil
+	},
+	"bool": func(s string) bool {
+		_, err := strconv.ParseBool(s)
+		return err == nil
+	},
+	"alpha": regexp.MustCompile(`^(?:` + patterns["alpha"] + `)$`).MatchString,
+	"alnum": regexp.MustCompile(`^(?:` + patterns["alnum"] + `)$`).MatchString,
+	"hex":   regexp.MustCompile(`^(?:` + patterns["hex"] + `)$`).MatchString,
+	"uuid":  regexp.MustCompile(`^(?:` + patterns["uuid"] + `)$`).MatchString,
+}
+
+// patterns are the regexps of the types, the ones of the parsed
+// types can match more values and only tell whether two constraints overlap.
+var patterns = map[string]string{
+	"int":   `[+-]?[0-9]+`,
+	"uint":  `[0-9]+`,
+	"float": `[+-]?([0-9_.]+([eEpP][+-]?[0-9_]+)?|0[xX][0-9a-fA-F_.]+([pP][+-]?[0-9_]+)?|(?i:inf|infinity|nan))`,
+	"bool":  `1|t|T|TRUE|true|True|0|f|F|FALSE|false|False`,
+	"alpha": `[a-zA-Z]+`,
+	"alnum": `[a-zA-Z0-9]+`,
+	"hex":   `[a-fA-F0-9]+`,
+	"uuid":  `[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-[a-fA-F0-9]{4}-[a-fA-F0-9]{4}-[a-fA-F0-9]{12}`,
+}
+
+type segment struct {
+	value      string
+	kind       kind
+	name       string
+	constraint string
+	match      func(string) bool
+}
+
+func kindOf(s string) kind {
+	switch {
+	case strings.HasPrefix(s, "*"):
+		return wildcardKind
+	case strings.HasPrefix(s, ":"):
+		return paramKind
+	case strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}"):
+		if strings.Contains(s, ":") {
+			return constrainedKind
+		}
+		return paramKind
+	default:
+		return staticKind
+	}
+}
+
+func parse(path string) ([]*segment, error) {
+
+	if path == "" {
+		return nil, errors.New("path is empty")
+	}
+
+	if path[0] != '/' {
+		return nil, errors.New(path + " must start with [/]")
+	}
+
+	if strings.Contains(path, "?") {
+		return nil, errors.New(path + " is include [?]")
+	}
+
+	var parts = strings.Split(path[1:], "/")
+
+	var res = make([]*segment, len(parts))
+
+	for i := 0; i < len(parts); i++ {
+		var s = &segment{value: parts[i], kind: kindOf(parts[i])}
+
+		switch s.kind {
+		case wildcardKind, paramKind:
+			s.name = strings.Trim(parts[i], "*:{}")
+		case constrainedKind:
+			var inner = parts[i][1 : len(parts[i])-1]
+			var index = strings.Index(inner, ":")
+			s.name = inner[:index]
+			s.constraint = inner[index+1:]
+			if fn, ok := types[s.constraint]; ok {
+				s.match = fn
+			} else {
+				re, err := regexp.Compile("^(?:" + s.constraint + ")$")
+				if err != nil {
+					return nil, errors.New(path + " is invalid, " + err.Error())
+				}
+				s.match = re.MatchString
+			}
+		}
+
+		if s.kind != staticKind && s.name == "" {
+			return nil, errors.New(path + " is invalid, [" + parts[i] + "] do not have any var")
+		}
+
+		res[i] = s
+	}
+
+	return res, nil
+}
+
+// Lower lowercases a path but keeps the constraint of every
+// {name:constraint} segment, so a regex like \D keeps its meaning.
+func Lower(path string) string {
+
+	var parts = strings.Split(path, "/")
+
+	for i := 0; i < len(parts); i++ {
+		if kindOf(parts[i]) != constrainedKind {
+			parts[i] = strings.ToLower(parts[i])
+			continue
+		}
+		var index = strings.Index(parts[i], ":")
+		parts[i] = strings.ToLower(parts[i][:index]) + parts[i][index:]
+	}
+
+	return strings.Join(parts, "/")
+}
+
+// Build fills the params of a path, every value is escaped and checked
+// against the constraint of its segment.
+func Build(path string, keys []string, values []string) (string, error) {
+	return build(path, keys, values, url.PathEscape)
+}
+
+// BuildRaw is Build without escaping, for the events of the socket
+// routers that are matched as they are. A value of a segment can not have a /.
+func BuildRaw(path string, keys []string, values []string) (string, error) {
+	return build(path, keys, values, nil)
+}
+
+func build(path string, keys []string, values []string, escape func(string) string) (string, error) {
+
+	segments, err := parse(path)
+	if err != nil {
+		return "", err
+	}
+
+	var get = func(name string) (string, bool) {
+		for i := 0; i < len(keys) && i < len(values); i++ {
+			if keys[i] == name {
+				return values[i], true
+			}
+		}
+		return "", false
+	}
+
+	var res = make([]string, len(segments))
+
+	for i := 0; i < len(segments); i++ {
+		var s = segments[i]
+
+		if s.kind == staticKind {
+			res[i] = s.value
+			continue
+		}
+
+		var value, ok = get(s.name)
+
+		if !ok {
+			return "", errors.New(path + " missing param [" + s.name + "]")
+		}
+
+		if s.kind == wildcardKind {
+			if escape == nil {
+				res[i] = value
+				continue
+			}
+			var parts = strings.Split(value, "/")
+			for j := 0; j < len(parts); j++ {
+				parts[j] = escape(parts[j])
+			}
+			res[i] = strings.Join(parts, "/")
+			continue
+		}
+
+		if value == "" {
+			return "", errors.New(path + " param [" + s.name + "] is empty")
+		}
+
+		if s.kind == constrainedKind && !s.match(value) {
+			return "", errors.New(path + " param [" + s.name + "] does not match " + s.constraint)
+		}
+
+		if escape == nil {
+			if strings.Contains(value, "/") {
+				return "", errors.New(path + " param [" + s.name + "] can not have a /")
+			}
+			res[i] = value
+			continue
+		}
+
+		res[i] = escape(value)
+	}
+
+	return "/" + strings.Join(res, "/"), nil
+}
@@ -0,0 +1,344 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-05 10:12
+**/
+
+package tire
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Tire is a segment tree used by every router.
+//
+// A path is split by "/" and each segment is one of:
+//
+//	static       /users
+//	constrained  /{id:int} or /{name:[a-z]+}
+//	param        /:id or /{id}
+//	wildcard     /*path (must be the last segment)
+//
+// When a request path is matched the children of a node are tried
+// in that order, so static wins over constrained, constrained over param
+// and param over wildcard. Two constrained children can not match
+// the same value, Insert returns a ConflictError for the second one.
+type Tire struct {
+	parent      *Tire
+	segment     string
+	kind        kind
+	name        string
+	constraint  string
+	match       func(string) bool
+	static      map[string]*Tire
+	constrained []*Tire
+	param       *Tire
+	wildcard    *Tire
+
+	Keys []string
+	Path []byte
+	Data interface{}
+}
+
+// ConflictError is returned by Insert when the path can not be told apart
+// from a path already in the tire, Conflict is the node of that path.
+type ConflictError struct {
+	Path     string
+	Conflict *Tire
+}
+
+func (e *ConflictError) Error() string {
+	return e.Path + " is conflict with " + string(e.Conflict.Path)
+}
+
+func (t *Tire) Insert(path string, data interface{}) error {
+
+	if data == nil {
+		return errors.New(path + " data can not be nil")
+	}
+
+	segments, err := parse(path)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(segments)-1; i++ {
+		if segments[i].kind == wildcardKind {
+			return errors.New(path + " is invalid, [*" + segments[i].name + "] must be the last segment")
+		}
+	}
+
+	var keys []string
+
+	var n = t
+
+	for i := 0; i < len(segments); i++ {
+		var s = segments[i]
+		if s.kind != staticKind {
+			keys = append(keys, s.name)
+		}
+		if c := n.overlap(s); c != nil {
+			return &ConflictError{Path: path, Conflict: c}
+		}
+		n = n.child(s)
+	}
+
+	if n.Data != nil {
+		return &ConflictError{Path: path, Conflict: n}
+	}
+
+	n.Keys = keys
+	n.Path = []byte(path)
+	n.Data = data
+
+	return nil
+}
+
+// Get returns the node inserted with a path of the same shape,
+// parameter names are not compared.
+func (t *Tire) Get(path string) *Tire {
+
+	segments, err := parse(path)
+	if err != nil {
+		return nil
+	}
+
+	var n = t
+
+	for i := 0; i < len(segments) && n != nil; i++ {
+		n = n.find(segments[i])
+	}
+
+	if n == nil || n.Data == nil {
+		return nil
+	}
+
+	return n
+}
+
+func (t *Tire) GetValue(pathBytes []byte) *Tire {
+
+	if len(pathBytes) == 0 || pathBytes[0] != '/' {
+		return nil
+	}
+
+	return t.lookup(strings.Split(string(pathBytes[1:]), "/"))
+}
+
+func (t *Tire) Delete(path string) {
+
+	var n = t.Get(path)
+
+	if n == nil {
+		return
+	}
+
+	n.Keys = nil
+	n.Path = nil
+	n.Data = nil
+
+	for n.parent != nil && n.Data == nil && n.empty() {
+		n.parent.remove(n)
+		n = n.parent
+	}
+}
+
+func (t *Tire) GetAllValue() []*Tire {
+
+	var res []*Tire
+
+	if t.Data != nil {
+		res = append(res, t)
+	}
+
+	var keys = make([]string, 0, len(t.static))
+	for k := range t.static {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for i := 0; i < len(keys); i++ {
+		res = append(res, t.static[keys[i]].GetAllValue()...)
+	}
+
+	for i := 0; i < len(t.constrained); i++ {
+		res = append(res, t.constrained[i].GetAllValue()...)
+	}
+
+	if t.param != nil {
+		res = append(res, t.param.GetAllValue()...)
+	}
+
+	if t.wildcard != nil {
+		res = append(res, t.wildcard.GetAllValue()...)
+	}
+
+	return res
+}
+
+func (t *Tire) ParseParams(pathBytes []byte) []string {
+
+	if len(t.Keys) == 0 || len(pathBytes) == 0 {
+		return nil
+	}
+
+	var pattern = strings.Split(string(t.Path[1:]), "/")
+
+	var path = strings.Split(string(pathBytes[1:]), "/")
+
+	var res []string
+
+	for i := 0; i < len(pattern) && i < len(path); i++ {
+		switch kindOf(pattern[i]) {
+		case staticKind:
+			continue
+		case wildcardKind:
+			res = append(res, strings.Join(path[i:], "/"))
+			return res
+		default:
+			res = append(res, path[i])
+		}
+	}
+
+	return res
+}
+
+func (t *Tire) lookup(segments []string) *Tire {
+
+	if len(segments) == 0 {
+		if t.Data != nil {
+			return t
+		}
+		return nil
+	}
+
+	var s = segments[0]
+
+	if n, ok := t.static[s]; ok {
+		if r := n.lookup(segments[1:]); r != nil {
+			return r
+		}
+	}
+
+	if s != "" {
+		for i := 0; i < len(t.constrained); i++ {
+			if !t.constrained[i].match(s) {
+				continue
+			}
+			if r := t.constrained[i].lookup(segments[1:]); r != nil {
+				return r
+			}
+		}
+
+		if t.param != nil {
+			if r := t.param.lookup(segments[1:]); r != nil {
+				return r
+			}
+		}
+	}
+
+	if t.wildcard != nil && t.wildcard.Data != nil {
+		return t.wildcard
+	}
+
+	return nil
+}
+
+func (t *Tire) find(s *segment) *Tire {
+	switch s.kind {
+	case staticKind:
+		return t.static[s.value]
+	case constrainedKind:
+		for i := 0; i < len(t.constrained); i++ {
+			if t.constrained[i].constraint == s.constraint {
+				return t.constrained[i]
+			}
+		}
+		return nil
+	case paramKind:
+		return t.param
+	default:
+		return t.wildcard
+	}
+}
+
+// overlap returns a node under a constrained child that can match
+// the values of s, nil when s is a child already or matches none of them.
+func (t *Tire) overlap(s *segment) *Tire {
+
+	if s.kind != constrainedKind || t.find(s) != nil {
+		return nil
+	}
+
+	for i := 0; i < len(t.constrained); i++ {
+		var nodes = t.constrained[i].GetAllValue()
+		if len(nodes) == 0 {
+			continue
+		}
+		if overlap(pattern(t.constrained[i].constraint), pattern(s.constraint)) {
+			return nodes[0]
+		}
+	}
+
+	return nil
+}
+
+func (t *Tire) child(s *segment) *Tire {
+
+	if n := t.find(s); n != nil {
+		return n
+	}
+
+	var n = &Tire{
+		parent:     t,
+		segment:    s.value,
+		kind:       s.kind,
+		name:       s.name,
+		constraint: s.constraint,
+		match:      s.match,
+	}
+
+	switch s.kind {
+	case staticKind:
+		if t.static == nil {
+			t.static = make(map[string]*Tire)
+		}
+		t.static[s.value] = n
+	case constrainedKind:
+		t.constrained = append(t.constrained, n)
+	case paramKind:
+		t.param = n
+	default:
+		t.wildcard = n
+	}
+
+	return n
+}
+
+func (t *Tire) remove(n *Tire) {
+	switch n.kind {
+	case staticKind:
+		delete(t.static, n.segment)
+	case constrainedKind:
+		for i := 0; i < len(t.constrained); i++ {
+			if t.constrained[i] == n {
+				t.constrained = append(t.constrained[:i], t.constrained[i+1:]...)
+				break
+			}
+		}
+	case paramKind:
+		t.param = nil
+	default:
+		t.wildcard = nil
+	}
+}
+
+func (t *Tire) empty() bool {
+	return len(t.static) == 0 && len(t.constrained) == 0 && t.param == nil && t.wildcard == nil
+}
@@ -0,0 +1,148 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-05 14:20
+**/
+
+package tire
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Tire_Priority(t *testing.T) {
+
+	var tree = new(Tire)
+
+	assert.Nil(t, tree.Insert("/files/*path", "wildcard"))
+	assert.Nil(t, tree.Insert("/files/:name", "param"))
+	assert.Nil(t, tree.Insert("/files/{id:int}", "int"))
+	assert.Nil(t, tree.Insert("/files/{code:[a-z]{3}}", "regex"))
+	assert.Nil(t, tree.Insert("/files/new", "static"))
+
+	var match = func(path string) interface{} {
+		var n = tree.GetValue([]byte(path))
+		if n == nil {
+			return nil
+		}
+		return n.Data
+	}
+
+	assert.Equal(t, "static", match("/files/new"))
+	assert.Equal(t, "int", match("/files/123"))
+	assert.Equal(t, "regex", match("/files/abc"))
+	assert.Equal(t, "param", match("/files/abcd"))
+	assert.Equal(t, "wildcard", match("/files/a/b/c.txt"))
+	assert.Equal(t, "wildcard", match("/files/"))
+	assert.Nil(t, match("/files"))
+
+	var n = tree.GetValue([]byte("/files/a/b/c.txt"))
+	assert.Equal(t, []string{"path"}, n.Keys)
+	assert.Equal(t, []string{"a/b/c.txt"}, n.ParseParams([]byte("/files/a/b/c.txt")))
+
+	n = tree.GetValue([]byte("/files/123"))
+	assert.Equal(t, []string{"id"}, n.Keys)
+	assert.Equal(t, []string{"123"}, n.ParseParams([]byte("/files/123")))
+}
+
+func Test_Tire_Backtrack(t *testing.T) {
+
+	var tree = new(Tire)
+
+	assert.Nil(t, tree.Insert("/users/{id:int}/posts", "int"))
+	assert.Nil(t, tree.Insert("/users/:name/profile", "param"))
+
+	assert.Equal(t, "param", tree.GetValue([]byte("/users/123/profile")).Data)
+	assert.Equal(t, "int", tree.GetValue([]byte("/users/123/posts")).Data)
+	assert.Nil(t, tree.GetValue([]byte("/users/abc/posts")))
+}
+
+func Test_Tire_Conflict(t *testing.T) {
+
+	var tree = new(Tire)
+
+	assert.Nil(t, tree.Insert("/users/:id", "a"))
+
+	var err = tree.Insert("/users/:name", "b")
+	assert.IsType(t, &ConflictError{}, err)
+	assert.Equal(t, "/users/:id", string(err.(*ConflictError).Conflict.Path))
+
+	assert.Nil(t, tree.Insert("/users/{id:int}", "c"))
+	assert.IsType(t, &ConflictError{}, tree.Insert("/users/{uid:int}", "d"))
+
+	assert.NotNil(t, tree.Insert("/files/*path/more", "e"))
+	assert.NotNil(t, tree.Insert("/files/{id:[}", "f"))
+	assert.NotNil(t, tree.Insert("/files/:", "g"))
+}
+
+func Test_Tire_Overlap(t *testing.T) {
+
+	var tree = new(Tire)
+
+	assert.Nil(t, tree.Insert("/u/{a:int}", "int"))
+
+	var err = tree.Insert("/u/{b:[0-9]+}", "digits")
+	assert.IsType(t, &ConflictError{}, err)
+	assert.Equal(t, "/u/{a:int}", string(err.(*ConflictError).Conflict.Path))
+	assert.Equal(t, "int", tree.GetValue([]byte("/u/1")).Data)
+
+	assert.IsType(t, &ConflictError{}, tree.Insert("/u/{b:1|x}/more", "alt"))
+	assert.IsType(t, &ConflictError{}, tree.Insert("/u/{b:float}", "float"))
+	assert.IsType(t, &ConflictError{}, tree.Insert("/u/{b:.+}", "any"))
+
+	// they can not match the same value
+	assert.Nil(t, tree.Insert("/u/{b:alpha}", "alpha"))
+	assert.Nil(t, tree.Insert("/u/{b:uuid}", "uuid"))
+	assert.Nil(t, tree.Insert("/u/{b:x[0-9]+}", "x"))
+	assert.Nil(t, tree.Insert("/u/{a:int}/more", "more"))
+
+	assert.True(t, overlap(pattern("int"), pattern("uint")))
+	assert.True(t, overlap(pattern("bool"), pattern("int")))
+	assert.True(t, overlap(pattern("hex"), `(?i)F`))
+	assert.False(t, overlap(pattern("alpha"), pattern("int")))
+	assert.False(t, overlap(`a*`, `b*`))
+}
+
+func Test_Tire_Delete(t *testing.T) {
+
+	var tree = new(Tire)
+
+	assert.Nil(t, tree.Insert("/a/:b/c", "abc"))
+	assert.Nil(t, tree.Insert("/a/:b", "ab"))
+
+	tree.Delete("/a/:b/c")
+
+	assert.Nil(t, tree.GetValue([]byte("/a/1/c")))
+	assert.Equal(t, "ab", tree.GetValue([]byte("/a/1")).Data)
+	assert.Len(t, tree.GetAllValue(), 1)
+}
+
+func Test_Tire_Lower(t *testing.T) {
+	assert.Equal(t, "/users/{id:[A-Z]+}/posts", Lower("/Users/{ID:[A-Z]+}/Posts"))
+}
+
+func Test_Tire_Build(t *testing.T) {
+
+	var res, err = Build("/users/{id:int}/files/*path", []string{"id", "path"}, []string{"12", "a b/c.txt"})
+	assert.Nil(t, err)
+	assert.Equal(t, "/users/12/files/a%20b/c.txt", res)
+
+	_, err = Build("/users/{id:int}", []string{"id"}, []string{"abc"})
+	assert.NotNil(t, err)
+
+	_, err = Build("/users/:id", nil, nil)
+	assert.NotNil(t, err)
+
+	res, err = BuildRaw("/users/:name/*path", []string{"name", "path"}, []string{"a b", "c d/e"})
+	assert.Nil(t, err)
+	assert.Equal(t, "/users/a b/c d/e", res)
+
+	_, err = BuildRaw("/users/:name", []string{"name"}, []string{"a/b"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,284 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-12 10:34
+**/
+
+package kitty
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSOptions is the TLS of the http, websocket and tcp servers
+// and of the tcp client.
+type TLSOptions struct {
+	// Config is the base config, it is cloned.
+	Config *tls.Config
+
+	// CertFile and KeyFile are the default key pair,
+	// the client sends it when the server asks for one.
+	CertFile string
+	KeyFile  string
+
+	// Certificates are chosen by SNI, the key is the server name
+	// like api.example.com or *.example.com.
+	Certificates map[string]KeyPair
+
+	// ClientCAFile verifies the certificates of the clients,
+	// ClientAuth is RequireAndVerifyClientCert unless it is set.
+	ClientCAFile string
+	ClientAuth   tls.ClientAuthType
+
+	// RootCAFile verifies the certificate of the server on the client.
+	RootCAFile string
+	ServerName string
+
+	// ReloadInterval checks the files and reloads the key pairs
+	// when they change, 0 disables it. Reload can be called as well.
+	// The check starts with ServerConfig or ClientConfig and stops on Close.
+	ReloadInterval time.Duration
+
+	mux      sync.RWMutex
+	stop     chan struct{}
+	cert     *tls.Certificate
+	certs    map[string]*tls.Certificate
+	modTimes map[string]time.Time
+}
+
+type KeyPair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// ServerConfig returns the config of a server, the key pairs
+// are served by GetCertificate so a reload needs no restart.
+func (o *TLSOptions) ServerConfig() (*tls.Config, error) {
+
+	if err := o.Reload(); err != nil {
+		return nil, err
+	}
+
+	var config = o.clone()
+
+	config.GetCertificate = o.getCertificate
+
+	if o.ClientCAFile != "" {
+		pool, err := loadPool(o.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = o.ClientAuth
+		if config.ClientAuth == tls.NoClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	o.watch()
+
+	return config, nil
+}
+
+// ClientConfig returns the config of a client, addr is used
+// as the server name when ServerName is empty.
+func (o *TLSOptions) ClientConfig(addr string) (*tls.Config, error) {
+
+	if err := o.Reload(); err != nil {
+		return nil, err
+	}
+
+	var config = o.clone()
+
+	if o.CertFile != "" {
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			o.mux.RLock()
+			defer o.mux.RUnlock()
+			return o.cert, nil
+		}
+	}
+
+	if o.RootCAFile != "" {
+		pool, err := loadPool(o.RootCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+
+	if o.ServerName != "" {
+		config.ServerName = o.ServerName
+	}
+
+	if config.ServerName == "" {
+		config.ServerName = addr
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			config.ServerName = host
+		}
+	}
+
+	o.watch()
+
+	return config, nil
+}
+
+// Reload loads every key pair from disk again,
+// the old ones are kept when one of them fails.
+func (o *TLSOptions) Reload() error {
+
+	var cert *tls.Certificate
+	var certs = make(map[string]*tls.Certificate)
+	var modTimes = make(map[string]time.Time)
+
+	var load = func(pair KeyPair) (*tls.Certificate, error) {
+		c, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range []string{pair.CertFile, pair.KeyFile} {
+			if info, err := os.Stat(file); err == nil {
+				modTimes[file] = info.ModTime()
+			}
+		}
+		return &c, nil
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		c, err := load(KeyPair{CertFile: o.CertFile, KeyFile: o.KeyFile})
+		if err != nil {
+			return err
+		}
+		cert = c
+	}
+
+	for name, pair := range o.Certificates {
+		c, err := load(pair)
+		if err != nil {
+			return errors.New(name + " " + err.Error())
+		}
+		certs[strings.ToLower(name)] = c
+	}
+
+	o.mux.Lock()
+	o.cert = cert
+	o.certs = certs
+	o.modTimes = modTimes
+	o.mux.Unlock()
+
+	return nil
+}
+
+func (o *TLSOptions) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+
+	o.mux.RLock()
+	defer o.mux.RUnlock()
+
+	var name = strings.ToLower(hello.ServerName)
+
+	if c, ok := o.certs[name]; ok {
+		return c, nil
+	}
+
+	if index := strings.Index(name, "."); index != -1 {
+		if c, ok := o.certs["*"+name[index:]]; ok {
+			return c, nil
+		}
+	}
+
+	if o.cert != nil {
+		return o.cert, nil
+	}
+
+	// fall back to Config.Certificates
+	return nil, nil
+}
+
+func (o *TLSOptions) clone() *tls.Config {
+	if o.Config == nil {
+		return &tls.Config{}
+	}
+	return o.Config.Clone()
+}
+
+// Close stops the check of ReloadInterval, the servers call it on
+// Shutdown and the tcp client on Close. The options that are shared
+// stop for every user, the next ServerConfig or ClientConfig starts it again.
+func (o *TLSOptions) Close() {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	if o.stop != nil {
+		close(o.stop)
+		o.stop = nil
+	}
+}
+
+// watch starts the check once until Close.
+func (o *TLSOptions) watch() {
+
+	if o.ReloadInterval <= 0 {
+		return
+	}
+
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	if o.stop != nil {
+		return
+	}
+
+	o.stop = make(chan struct{})
+
+	go o.check(o.stop, o.ReloadInterval)
+}
+
+func (o *TLSOptions) check(stop chan struct{}, interval time.Duration) {
+
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if o.changed() {
+				_ = o.Reload()
+			}
+		}
+	}
+}
+
+func (o *TLSOptions) changed() bool {
+	o.mux.RLock()
+	defer o.mux.RUnlock()
+	for file, modTime := range o.modTimes {
+		if info, err := os.Stat(file); err == nil && !info.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+func loadPool(file string) (*x509.CertPool, error) {
+	bts, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var pool = x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bts) {
+		return nil, errors.New(file + " has no certificate")
+	}
+	return pool, nil
+}
@@ -0,0 +1,336 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-17 09:15
+**/
+
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Rule reports whether v is valid, param is the text after = in the tag.
+type Rule func(v reflect.Value, param string) bool
+
+// FieldError is a field that breaks a rule.
+type FieldError struct {
+	// Field is the path of the field, like User.Name or Items[0].Name
+	Field string `json:"field"`
+	// Key is the name in the json, form, query, path or header tag
+	Key     string `json:"key"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// Errors lists every field that breaks a rule,
+// it is the msg of a 422 JsonFormat.
+type Errors struct {
+	Fields []*FieldError `json:"fields"`
+}
+
+func (e *Errors) Error() string {
+	var msg = make([]string, len(e.Fields))
+	for i := 0; i < len(e.Fields); i++ {
+		msg[i] = e.Fields[i].Error()
+	}
+	return "validate: " + strings.Join(msg, "; ")
+}
+
+// keyTags name a field in the FieldError.
+var keyTags = []string{"json", "form", "query", "path", "header"}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+var mux sync.RWMutex
+
+var rules = map[string]Rule{
+	"required": func(v reflect.Value, param string) bool { return !empty(v) },
+	"min":      func(v reflect.Value, param string) bool { return compare(v, param) >= 0 },
+	"max":      func(v reflect.Value, param string) bool { return compare(v, param) <= 0 },
+	"len":      func(v reflect.Value, param string) bool { return compare(v, param) == 0 },
+	"email":    email,
+	"url":      isURL,
+	"oneof":    oneOf,
+}
+
+var messages = map[string]string{
+	"required": "is required",
+	"min":      "must be at least %s",
+	"max":      "must be at most %s",
+	"len":      "must have a length of %s",
+	"email":    "must be an email",
+	"url":      "must be a url",
+	"oneof":    "must be one of %s",
+}
+
+// Register adds a rule or replaces the one with the same name.
+//
+//	validate.Register("even", func(v reflect.Value, param string) bool {
+//		return v.Int()%2 == 0
+//	})
+func Register(name string, rule Rule) {
+	if name == "" || name == "omitempty" || rule == nil {
+		panic("rule is invalid")
+	}
+	mux.Lock()
+	defer mux.Unlock()
+	rules[name] = rule
+}
+
+// Struct checks the validate tags of input, a struct or a pointer to one,
+// and of its nested structs. It returns *Errors or nil.
+//
+//	Name  string `validate:"required,min=1,max=64"`
+//	Email string `validate:"omitempty,email"`
+//	Kind  string `validate:"oneof=a b"`
+func Struct(input interface{}) error {
+
+	var v = reflect.ValueOf(input)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			panic("input is invalid or nil")
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		panic("input must be a struct")
+	}
+
+	var errs Errors
+
+	check(v, "", &errs)
+
+	if len(errs.Fields) == 0 {
+		return nil
+	}
+
+	return &errs
+}
+
+func check(v reflect.Value, prefix string, errs *Errors) {
+
+	var t = v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+
+		var field = t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		var name = prefix + field.Name
+		var value = v.Field(i)
+
+		if !checkField(field, value, name, errs) {
+			continue
+		}
+
+		dive(value, name, errs)
+	}
+}
+
+// checkField returns false when a rule fails or the value is omitted.
+func checkField(field reflect.StructField, value reflect.Value, name string, errs *Errors) bool {
+
+	var tag = field.Tag.Get("validate")
+	if tag == "" || tag == "-" {
+		return true
+	}
+
+	var parts = strings.Split(tag, ",")
+
+	for i := 0; i < len(parts); i++ {
+
+		var ruleName, param = parts[i], ""
+		if j := strings.IndexByte(parts[i], '='); j != -1 {
+			ruleName, param = parts[i][:j], parts[i][j+1:]
+		}
+
+		if ruleName == "omitempty" {
+			if empty(value) {
+				return false
+			}
+			continue
+		}
+
+		mux.RLock()
+		var rule, ok = rules[ruleName]
+		mux.RUnlock()
+		if !ok {
+			panic("unknown rule " + ruleName + " of " + name)
+		}
+
+		var v = value
+
+		// the rules check the value of a pointer
+		if ruleName != "required" {
+			for v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					return false
+				}
+				v = v.Elem()
+			}
+		}
+
+		if rule(v, param) {
+			continue
+		}
+
+		var msg, has = messages[ruleName]
+		if !has {
+			msg = "is invalid"
+		}
+		if strings.Contains(msg, "%s") {
+			msg = fmt.Sprintf(msg, param)
+		}
+
+		errs.Fields = append(errs.Fields, &FieldError{Field: name, Key: key(field), Rule: ruleName, Param: param, Message: msg})
+
+		return false
+	}
+
+	return true
+}
+
+// dive checks the nested structs, the structs of a slice included.
+func dive(v reflect.Value, name string, errs *Errors) {
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() != timeType {
+			check(v, name+".", errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			dive(v.Index(i), name+"["+strconv.Itoa(i)+"]", errs)
+		}
+	}
+}
+
+func key(field reflect.StructField) string {
+	for i := 0; i < len(keyTags); i++ {
+		var tag = field.Tag.Get(keyTags[i])
+		if j := strings.IndexByte(tag, ','); j != -1 {
+			tag = tag[:j]
+		}
+		if tag != "" && tag != "-" {
+			return tag
+		}
+	}
+	return field.Name
+}
+
+func empty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+// compare compares a number with param, or the length
+// of a string, a slice or a map. A duration takes a param like 1s.
+func compare(v reflect.Value, param string) int {
+
+	var n float64
+
+	switch v.Kind() {
+	case reflect.String:
+		n = float64(utf8.RuneCountInString(v.String()))
+	case reflect.Slice, reflect.Map, reflect.Array:
+		n = float64(v.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == durationType {
+			if d, err := time.ParseDuration(param); err == nil {
+				param = strconv.FormatInt(int64(d), 10)
+			}
+		}
+		n = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = v.Float()
+	default:
+		panic("can not compare " + v.Type().String())
+	}
+
+	p, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic("param " + param + " is not a number")
+	}
+
+	switch {
+	case n < p:
+		return -1
+	case n > p:
+		return 1
+	}
+
+	return 0
+}
+
+func email(v reflect.Value, param string) bool {
+	addr, err := mail.ParseAddress(v.String())
+	return err == nil && addr.Address == v.String()
+}
+
+func isURL(v reflect.Value, param string) bool {
+	u, err := url.ParseRequestURI(v.String())
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+func oneOf(v reflect.Value, param string) bool {
+	var value = text(v)
+	var values = strings.Fields(param)
+	for i := 0; i < len(values); i++ {
+		if values[i] == value {
+			return true
+		}
+	}
+	return false
+}
+
+// text formats v without Interface, which panics on an unexported embedded struct.
+func text(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	}
+	return v.String()
+}
@@ -0,0 +1,93 @@
+/**
+* @program: kitty
+*
+* @description:
+*
+* @author: lemo
+*
+* @create: 2021-07-17 11:30
+**/
+
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type item struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type input struct {
+	Name    string        `json:"name" validate:"required,min=2,max=4"`
+	Email   string        `validate:"omitempty,email"`
+	Site    string        `validate:"omitempty,url"`
+	Kind    string        `validate:"oneof=a b"`
+	Age     *int          `validate:"omitempty,min=18"`
+	Code    string        `validate:"len=3"`
+	Timeout time.Duration `validate:"max=1s"`
+	Even    int           `validate:"even"`
+	Items   []item        `validate:"min=1"`
+	Owner   *item
+}
+
+func Test_Validate(t *testing.T) {
+
+	Register("even", func(v reflect.Value, param string) bool {
+		return v.Int()%2 == 0
+	})
+
+	var age = 20
+
+	var ok = input{
+		Name: "lemo", Email: "a@b.com", Site: "https://a.com/b", Kind: "b", Age: &age,
+		Code: "abc", Timeout: time.Second, Even: 2, Items: []item{{Name: "a"}},
+	}
+
+	assert.Nil(t, Struct(&ok))
+
+	age = 1
+
+	var bad = input{
+		Name: "l", Email: "a@", Site: "a.com", Kind: "c", Age: &age,
+		Code: "ab", Timeout: time.Minute, Even: 1, Items: []item{{}}, Owner: &item{},
+	}
+
+	var err = Struct(bad)
+
+	var e *Errors
+	assert.True(t, errors.As(err, &e), err)
+
+	var fields = make(map[string]*FieldError)
+	for i := 0; i < len(e.Fields); i++ {
+		fields[e.Fields[i].Field] = e.Fields[i]
+	}
+
+	assert.Equal(t, 10, len(e.Fields), err.Error())
+	assert.Equal(t, "min", fields["Name"].Rule)
+	assert.Equal(t, "name", fields["Name"].Key)
+	assert.Equal(t, "must be at least 2", fields["Name"].Message)
+	assert.Equal(t, "email", fields["Email"].Rule)
+	assert.Equal(t, "url", fields["Site"].Rule)
+	assert.Equal(t, "must be one of a b", fields["Kind"].Message)
+	assert.Equal(t, "min", fields["Age"].Rule)
+	assert.Equal(t, "len", fields["Code"].Rule)
+	assert.Equal(t, "max", fields["Timeout"].Rule)
+	assert.Equal(t, "is invalid", fields["Even"].Message)
+	assert.Equal(t, "required", fields["Items[0].Name"].Rule)
+	assert.Equal(t, "required", fields["Owner.Name"].Rule)
+
+	// the first failed rule of a field only
+	assert.Equal(t, "required", Struct(&input{Kind: "a", Code: "abc", Items: []item{{Name: "a"}}}).(*Errors).Fields[0].Rule)
+
+	assert.Panics(t, func() {
+		_ = Struct(&struct {
+			A string `validate:"unknown"`
+		}{})
+	})
+}